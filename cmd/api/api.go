@@ -5,14 +5,18 @@ import (
 	"errors"
 	"expvar"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/NR3101/social/internal/auth"
 	"github.com/NR3101/social/internal/env"
 	"github.com/NR3101/social/internal/mailer"
+	"github.com/NR3101/social/internal/media"
+	"github.com/NR3101/social/internal/oidc"
 	"github.com/NR3101/social/internal/rateLimiter"
 	"github.com/NR3101/social/internal/store"
 	"github.com/NR3101/social/internal/store/cache"
@@ -24,13 +28,17 @@ import (
 
 // application struct holds the configuration and storage for the application
 type application struct {
-	config        config              // configuration for the application
-	store         store.Storage       // storage interface for database operations
-	cacheStorage  cache.Storage       // cache storage interface for caching operations
-	logger        *zap.SugaredLogger  // logger for logging messages
-	mailer        mailer.Client       // mailer client for sending emails
-	authenticator auth.Authenticator  // authenticator for handling user authentication
-	rateLimiter   rateLimiter.Limiter // rate limiter for controlling request rates
+	config        config                    // configuration for the application
+	store         store.Storage             // storage interface for database operations
+	cacheStorage  cache.Storage             // cache storage interface for caching operations
+	logger        *zap.SugaredLogger        // logger for logging messages
+	mailer        mailer.Client             // mailer client for sending emails
+	authenticator auth.Authenticator        // authenticator for handling user authentication
+	rateLimiter   rateLimiter.Limiter       // rate limiter for controlling request rates
+	wg            sync.WaitGroup            // tracks background tasks so shutdown can wait for them
+	oidcProviders map[string]*oidc.Provider // identity providers users can sign in with, by name
+	operators     *auth.Operators           // operator accounts allowed to reach the health and metrics endpoints
+	blobs         media.BlobStore           // storage for the content of uploaded files
 }
 
 // config struct holds the database configuration
@@ -43,6 +51,41 @@ type config struct {
 	auth        authConfig         // authentication configuration
 	redisCfg    redisConfig        // Redis configuration for caching
 	rateLimiter rateLimiter.Config // rate limiting configuration
+	sweeper     sweeperConfig      // configuration for purging accounts that were never activated
+	publisher   publisherConfig    // configuration for publishing scheduled posts
+	media       mediaConfig        // configuration for uploaded files
+	// trustedProxies are the addresses of the reverse proxies whose X-Forwarded-For and X-Real-IP headers are believed
+	trustedProxies []netip.Prefix
+}
+
+// mediaConfig struct holds the configuration for uploaded files
+type mediaConfig struct {
+	maxSize          int64          // maximum size of an uploaded file in bytes
+	urlSecret        string         // secret key for signing download URLs
+	urlExp           time.Duration  // expiration time for download URLs
+	baseURL          string         // public URL of the API, which download URLs point at
+	backend          string         // where the content of files is stored, local or s3
+	localDir         string         // directory of the content with the local backend
+	s3               media.S3Config // bucket of the content with the s3 backend
+	sweepInterval    time.Duration  // time between two sweeps of unattached uploads
+	unattachedAge    time.Duration  // time an upload can stay unattached to any post before it is deleted
+	sweepSize        int            // number of uploads deleted per sweep
+	processInterval  time.Duration  // time between two checks for images to process
+	processBatchSize int            // number of images claimed at once for processing
+	processLease     time.Duration  // time after which an image whose processing did not finish is processed again
+	processAttempts  int            // number of times processing an image is attempted before giving up
+}
+
+// publisherConfig struct holds the configuration for publishing scheduled posts
+type publisherConfig struct {
+	interval  time.Duration // time between two checks for due posts
+	batchSize int           // number of posts published per transaction
+}
+
+// sweeperConfig struct holds the configuration for purging accounts that were never activated
+type sweeperConfig struct {
+	interval    time.Duration // time between two sweeps
+	gracePeriod time.Duration // time a user has to activate their account before it is deleted
 }
 
 // redisConfig struct holds the Redis configuration
@@ -55,26 +98,63 @@ type redisConfig struct {
 
 // authConfig struct holds the authentication configuration
 type authConfig struct {
-	basic basicAuthConfig // configuration for basic authentication
-	token tokenAuthConfig // configuration for token-based authentication
+	operators operatorAuthConfig // configuration for the operator accounts of the health and metrics endpoints
+	token     tokenAuthConfig    // configuration for token-based authentication
+	mfa       mfaConfig          // configuration for two-factor authentication
+	lockout   lockoutConfig      // configuration for brute-force protection of logins
+	magicLink magicLinkConfig    // configuration for passwordless sign-in links
+	oidc      oidcConfig         // configuration for signing in with external identity providers
+}
+
+// lockoutConfig struct holds the brute-force protection configuration for logins
+type lockoutConfig struct {
+	accountThreshold int           // failed logins for an email before it gets locked
+	ipThreshold      int           // failed logins from an IP address before it gets locked
+	baseLock         time.Duration // duration of the first lock, doubled with every further failure
+	maxLock          time.Duration // upper bound of the lock duration
+	window           time.Duration // failures older than this are forgotten
+}
+
+// oidcConfig struct holds the configuration for signing in with external identity providers
+type oidcConfig struct {
+	providers []oidc.Config // identity providers users can sign in with
+	stateExp  time.Duration // time a user has to complete a login at a provider
+}
+
+// magicLinkConfig struct holds the passwordless sign-in configuration
+type magicLinkConfig struct {
+	exp        time.Duration // expiration time for sign-in links
+	bindClient bool          // only accept a link from the IP address and user agent that requested it
+}
+
+// mfaConfig struct holds the two-factor authentication configuration
+type mfaConfig struct {
+	encryptionKey []byte        // AES key used to encrypt TOTP secrets at rest
+	pendingExp    time.Duration // expiration time for the tokens of logins waiting for a second factor
 }
 
 // tokenAuthConfig struct holds the token-based authentication configuration
 type tokenAuthConfig struct {
-	secret string        // secret key for signing tokens
-	exp    time.Duration // expiration time for tokens
-	iss    string        // issuer of the tokens
+	secret               string        // secret key for signing tokens, used when no signing key file is set
+	signingKeyFile       string        // PEM file of the RSA or Ed25519 private key for signing tokens
+	verificationKeyFiles []string      // PEM files of previous public keys still accepted during a key rotation
+	exp                  time.Duration // expiration time for access tokens
+	refreshExp           time.Duration // expiration time for refresh tokens
+	impersonationExp     time.Duration // expiration time for the tokens of administrators impersonating users
+	iss                  string        // issuer of the tokens
 }
 
-// basicAuthConfig struct holds the basic authentication configuration
-type basicAuthConfig struct {
-	username string // username for basic authentication
-	password string // password for basic authentication
+// operatorAuthConfig struct holds the configuration of the operator accounts guarding operational endpoints
+type operatorAuthConfig struct {
+	file     string // JSON file of the operator accounts with their password hashes, see auth.LoadOperators
+	username string // username of a single operator with access to every endpoint, used when no file is set
+	password string // password of that operator
 }
 
 // mailConfig struct holds the email configuration
 type mailConfig struct {
 	exp       time.Duration  // expiration time for email tokens
+	resetExp  time.Duration  // expiration time for password reset tokens
 	fromEmail string         // email address to send from
 	sendGrid  sendGridConfig // configuration for SendGrid mailer
 	mailTrap  mailTrapConfig // configuration for Mailtrap mailer
@@ -104,13 +184,13 @@ func (app *application) mount() http.Handler {
 
 	// A good base middleware stack
 	r.Use(middleware.RequestID) // adds a unique request ID to each request
-	r.Use(middleware.RealIP)    // extracts the real IP address of the client
+	r.Use(app.realIP)           // extracts the real IP address of the client from the headers of trusted proxies
 	r.Use(middleware.Logger)    // logs the start and end of each request
 	r.Use(middleware.Recoverer) // recovers from panics and writes a 500 response
 	// CORS (Cross-Origin Resource Sharing) middleware to allow cross-origin requests
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:3000")},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
@@ -121,54 +201,220 @@ func (app *application) mount() http.Handler {
 	// Set a timeout value on the request context (ctx), that will signal through ctx.Done() that the request has timed out and further processing should be stopped.
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	// Public keys for other services to verify the tokens issued here
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
+
 	// Group routes under /v1
 	r.Route("/v1", func(r chi.Router) {
-		// GET endpoint for health check with basic authentication
-		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthCheckHandler) // Health check endpoint
-		// GET endpoint for expvar metrics with basic authentication
-		r.With(app.BasicAuthMiddleware()).Get("/metrics", expvar.Handler().ServeHTTP)
+		// GET endpoint for health check with operator authentication
+		r.With(app.OperatorAuthMiddleware(auth.OperatorEndpointHealth)).Get("/health", app.healthCheckHandler) // Health check endpoint
+		// GET endpoint for expvar metrics with operator authentication
+		r.With(app.OperatorAuthMiddleware(auth.OperatorEndpointMetrics)).Get("/metrics", expvar.Handler().ServeHTTP)
 
 		// Routes related to posts
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware) // Middleware to authenticate requests using token-based authentication
 
-			r.Post("/", app.createPostHandler) // Create a new post
+			r.With(app.requireScope(scopePostsWrite)).Post("/", app.createPostHandler) // Create a new post
 
 			r.Route("/{postID}", func(r chi.Router) {
 				// Middleware to extract post ID from URL and load the post into the request context
 				r.Use(app.postsContextMiddleware)
 
-				r.Get("/", app.getPostHandler) // Get a specific post by ID
+				r.With(app.requireScope(scopePostsRead)).Get("/", app.getPostHandler) // Get a specific post by ID
 				// Delete a specific post by ID with ownership check
-				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+				r.With(app.requireScope(scopePostsWrite)).Delete("/", app.checkPostOwnership(permPostDeleteAny, app.deletePostHandler))
 				// Update a specific post by ID with ownership check
-				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				r.With(app.requireScope(scopePostsWrite)).Patch("/", app.checkPostOwnership(permPostUpdateAny, app.updatePostHandler))
+
+				// Share the post, as is or with commentary
+				r.With(app.requireScope(scopePostsWrite)).Post("/reposts", app.repostHandler)     // Repost the post
+				r.With(app.requireScope(scopePostsWrite)).Delete("/reposts", app.unrepostHandler) // Undo the repost of the post
+				r.With(app.requireScope(scopePostsWrite)).Post("/quotes", app.quotePostHandler)   // Quote the post
+
+				// Routes related to the previous versions of a post, which can hold what the author removed on purpose
+				r.Route("/revisions", func(r chi.Router) {
+					// List the versions of the post with ownership check
+					r.With(app.requireScope(scopePostsRead)).Get("/", app.checkPostOwnership(permPostUpdateAny, app.getPostRevisionsHandler))
+					// Get a version with its diff with ownership check
+					r.With(app.requireScope(scopePostsRead)).Get("/{version}", app.checkPostOwnership(permPostUpdateAny, app.getPostRevisionHandler))
+					// Restore a previous version with ownership check, for moderators to revert unwanted edits
+					r.With(app.requireScope(scopePostsWrite)).Post("/{version}/restore", app.checkPostOwnership(permPostUpdateAny, app.restorePostRevisionHandler))
+				})
+
+				// Routes related to the reactions to a post
+				r.Route("/reactions", func(r chi.Router) {
+					r.With(app.requireScope(scopePostsRead)).Get("/", app.getReactionsHandler)                 // List who reacted to the post
+					r.With(app.requireScope(scopeReactionsWrite)).Put("/{type}", app.addReactionHandler)       // React to the post
+					r.With(app.requireScope(scopeReactionsWrite)).Delete("/{type}", app.removeReactionHandler) // Remove a reaction
+				})
+
+				// Routes related to the comments of a post
+				r.Route("/comments", func(r chi.Router) {
+					// Get a paginated list of comments for the post
+					r.With(app.requireScope(scopePostsRead)).Get("/", app.getCommentsHandler)
+					// Create a new comment or reply on the post
+					r.With(app.requireScope(scopeCommentsWrite)).Post("/", app.createCommentHandler)
+					// Get a page of comment threads with nested replies
+					r.With(app.requireScope(scopePostsRead)).Get("/threads", app.getCommentThreadsHandler)
+
+					r.Route("/{commentID}", func(r chi.Router) {
+						// Middleware to extract comment ID from URL and load the comment into the request context
+						r.Use(app.commentsContextMiddleware)
+
+						// Get a page of replies to the comment
+						r.With(app.requireScope(scopePostsRead)).Get("/replies", app.getCommentRepliesHandler)
+
+						r.Group(func(r chi.Router) {
+							r.Use(app.requireScope(scopeCommentsWrite)) // Middleware to require the comments:write scope for API keys
+
+							// Update a specific comment by ID with ownership check
+							r.Patch("/", app.checkCommentOwnership(permCommentModerate, app.updateCommentHandler))
+							// Delete a specific comment by ID with ownership check
+							r.Delete("/", app.checkCommentOwnership(permCommentDeleteAny, app.deleteCommentHandler))
+						})
+					})
+				})
 			})
 		})
 
+		// Routes related to uploaded files
+		r.Route("/media", func(r chi.Router) {
+			// Upload a file to attach to a post
+			r.With(app.AuthTokenMiddleware, app.requireScope(scopePostsWrite)).Post("/", app.uploadMediaHandler)
+			// Download a file, authorized by the signature of the URL rather than by a token
+			r.Get("/{mediaID}/content", app.getMediaContentHandler)
+		})
+
 		// Routes related to users
 		r.Route("/users", func(r chi.Router) {
-			r.Put("/activate/{token}", app.activateUserHandler) // Activate a user account with a token
+			r.Put("/activate/{token}", app.activateUserHandler)       // Activate a user account with a token
+			r.Post("/activation/resend", app.resendActivationHandler) // Email a new activation link
+
+			// Routes related to the API keys of the authenticated user, which API keys cannot manage themselves
+			r.Route("/api-keys", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware) // Middleware to authenticate requests using token-based authentication
+				r.Use(app.denyAPIKey)          // Middleware to reject requests authenticated with an API key
+				r.Use(app.denyImpersonation)   // Middleware to reject requests made while impersonating a user
+
+				r.Get("/", app.getAPIKeysHandler)             // List the API keys of the user
+				r.Post("/", app.createAPIKeyHandler)          // Create a new API key
+				r.Delete("/{keyID}", app.deleteAPIKeyHandler) // Revoke an API key
+			})
+
+			// Routes related to the bookmark collections of the authenticated user
+			r.Route("/bookmarks/collections", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware) // Middleware to authenticate requests using token-based authentication
+
+				r.With(app.requireScope(scopeBookmarksRead)).Get("/", app.getBookmarkCollectionsHandler)     // List the collections
+				r.With(app.requireScope(scopeBookmarksWrite)).Post("/", app.createBookmarkCollectionHandler) // Create a collection
+
+				r.Route("/{collectionID}", func(r chi.Router) {
+					r.Use(app.bookmarkCollectionsContextMiddleware) // Middleware to load the collection into the request context
+
+					r.With(app.requireScope(scopeBookmarksRead)).Get("/", app.getBookmarkCollectionHandler)            // List the saved posts
+					r.With(app.requireScope(scopeBookmarksWrite)).Delete("/", app.deleteBookmarkCollectionHandler)     // Delete the collection
+					r.With(app.requireScope(scopeBookmarksWrite)).Put("/posts/{postID}", app.addBookmarkHandler)       // Save a post
+					r.With(app.requireScope(scopeBookmarksWrite)).Delete("/posts/{postID}", app.removeBookmarkHandler) // Take a post out
+				})
+			})
+
+			// Routes related to the notifications of the authenticated user
+			r.Route("/notifications", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware) // Middleware to authenticate requests using token-based authentication
+
+				r.With(app.requireScope(scopeNotificationsRead)).Get("/", app.getNotificationsHandler)                       // List the notifications
+				r.With(app.requireScope(scopeNotificationsWrite)).Put("/read", app.readAllNotificationsHandler)              // Mark every notification read
+				r.With(app.requireScope(scopeNotificationsWrite)).Put("/{notificationID}/read", app.readNotificationHandler) // Mark a notification read
+			})
 
 			r.Route("/{userID}", func(r chi.Router) {
 				// Middleware to authenticate requests using token-based authentication
 				r.Use(app.AuthTokenMiddleware)
 
-				r.Get("/", app.getUserHandler)              // Get a specific user by ID
-				r.Put("/follow", app.followUserHandler)     // Follow a user
-				r.Put("/unfollow", app.unfollowUserHandler) // Unfollow a user
+				r.With(app.requireScope(scopeUsersRead)).Get("/", app.getUserHandler)               // Get a specific user by ID
+				r.With(app.requireScope(scopeUsersWrite)).Put("/follow", app.followUserHandler)     // Follow a user
+				r.With(app.requireScope(scopeUsersWrite)).Put("/unfollow", app.unfollowUserHandler) // Unfollow a user
 			})
 
 			r.Group(func(r chi.Router) {
-				r.Use(app.AuthTokenMiddleware)         // Middleware to authenticate requests using token-based authentication
-				r.Get("/feed", app.getUserFeedHandler) // Get the feed for the authenticated user
+				r.Use(app.AuthTokenMiddleware)                                               // Middleware to authenticate requests using token-based authentication
+				r.With(app.requireScope(scopeFeedRead)).Get("/feed", app.getUserFeedHandler) // Get the feed for the authenticated user
+				// List the posts and comments mentioning the authenticated user
+				r.With(app.requireScope(scopeNotificationsRead)).Get("/mentions", app.getMentionsHandler)
+			})
+		})
+
+		// Routes reserved to administrators
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware) // Middleware to authenticate requests using token-based authentication
+			r.Use(app.denyAPIKey)          // Middleware to reject requests authenticated with an API key
+			r.Use(app.denyImpersonation)   // Middleware to reject requests made while impersonating a user
+
+			// Mint a short-lived token to act as a user
+			r.With(app.requirePermission(permUserImpersonate)).Post("/users/{userID}/impersonate", app.impersonateUserHandler)
+			// Clear the failed logins and lock of an account
+			r.With(app.requirePermission(permUserUnlock)).Delete("/users/{userID}/lockout", app.unlockUserHandler)
+			// List the accounts awaiting activation
+			r.With(app.requirePermission(permInvitationRead)).Get("/invitations", app.getInvitationsHandler)
+
+			// Query and export the audit trail
+			r.With(app.requirePermission(permAuditRead)).Get("/audit-events", app.getAuditEventsHandler)
+			r.With(app.requirePermission(permAuditRead)).Get("/audit-events/export", app.exportAuditEventsHandler)
+
+			// Routes related to roles and the roles of users
+			r.Group(func(r chi.Router) {
+				r.Use(app.requirePermission(permRoleManage)) // Middleware to require the permission to manage roles
+
+				r.Get("/roles", app.getRolesHandler)    // List all roles with their permissions
+				r.Post("/roles", app.createRoleHandler) // Create a new role
+
+				r.Route("/roles/{roleID}", func(r chi.Router) {
+					// Middleware to extract role ID from URL and load the role into the request context
+					r.Use(app.rolesContextMiddleware)
+
+					r.Get("/", app.getRoleHandler)       // Get a specific role by ID
+					r.Patch("/", app.updateRoleHandler)  // Update a role and its permissions
+					r.Delete("/", app.deleteRoleHandler) // Delete a role
+				})
+
+				r.With(app.rolesContextMiddleware).Put("/users/{userID}/roles/{roleID}", app.assignUserRoleHandler)    // Grant a role to a user
+				r.With(app.rolesContextMiddleware).Delete("/users/{userID}/roles/{roleID}", app.removeUserRoleHandler) // Take a role away from a user
 			})
 		})
 
 		// Routes related to authentication
 		r.Route("/authentication", func(r chi.Router) {
-			r.Post("/user", app.registerUserHandler) // Register a new user
-			r.Post("/token", app.createTokenHandler) // Create a new authentication token
+			r.Post("/user", app.registerUserHandler)    // Register a new user
+			r.Post("/token", app.createTokenHandler)    // Create a new authentication token
+			r.Post("/refresh", app.refreshTokenHandler) // Exchange a refresh token for a new token pair
+			r.Post("/logout", app.logoutHandler)        // Revoke the session of a refresh token
+
+			r.Post("/magic-link", app.requestMagicLinkHandler)       // Email a passwordless sign-in link
+			r.Post("/magic-link/verify", app.verifyMagicLinkHandler) // Log in with a sign-in link
+
+			// Routes related to signing in with an external identity provider
+			r.Route("/oidc/{provider}", func(r chi.Router) {
+				r.Get("/login", app.oidcLoginHandler)       // Redirect to the login page of the provider
+				r.Get("/callback", app.oidcCallbackHandler) // Complete a login at the provider
+			})
+
+			r.Post("/password/forgot", app.forgotPasswordHandler) // Email a password reset link
+			r.Post("/password/reset", app.resetPasswordHandler)   // Reset a password with a token
+
+			// Routes related to two-factor authentication
+			r.Route("/mfa", func(r chi.Router) {
+				r.Post("/verify", app.verifyMFAHandler) // Complete a login with a second factor
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)            // Middleware to authenticate requests using token-based authentication
+					r.Use(app.denyAPIKey)                     // Middleware to reject requests authenticated with an API key
+					r.Use(app.denyImpersonation)              // Middleware to reject requests made while impersonating a user
+					r.Post("/enroll", app.enrollMFAHandler)   // Generate a new TOTP secret
+					r.Post("/enable", app.enableMFAHandler)   // Enable two-factor authentication with a first code
+					r.Post("/disable", app.disableMFAHandler) // Disable two-factor authentication
+				})
+			})
 		})
 	})
 
@@ -189,6 +435,11 @@ func (app *application) run(mux http.Handler) error {
 
 	shutdown := make(chan error) // channel to signal shutdown completion
 
+	// Start the background workers, they are stopped once the server stops accepting requests
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	app.startWorkers(workersCtx)
+
 	// Goroutine to listen for OS signals (SIGINT, SIGTERM) and initiate graceful shutdown
 	go func() {
 		quit := make(chan os.Signal, 1) // channel to receive OS signals
@@ -204,7 +455,17 @@ func (app *application) run(mux http.Handler) error {
 		// Log the signal received
 		app.logger.Infow("Signal caught", "signal", s.String())
 
-		shutdown <- srv.Shutdown(ctx) // initiate graceful shutdown of the server
+		err := srv.Shutdown(ctx) // initiate graceful shutdown of the server
+		if err != nil {
+			shutdown <- err
+			return
+		}
+
+		// Stop the workers and wait for background tasks, such as sending emails, to finish
+		stopWorkers()
+		app.logger.Infow("Waiting for background tasks to complete", "addr", app.config.addr)
+		app.wg.Wait()
+		shutdown <- nil
 	}()
 
 	// Start the HTTP server
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Scopes that can be granted to API keys
+const (
+	scopePostsRead          = "posts:read"          // Read posts and their comments
+	scopePostsWrite         = "posts:write"         // Create, update and delete posts
+	scopeCommentsWrite      = "comments:write"      // Create, update and delete comments
+	scopeReactionsWrite     = "reactions:write"     // Add and remove reactions to posts
+	scopeFeedRead           = "feed:read"           // Read the feed of the user
+	scopeBookmarksRead      = "bookmarks:read"      // Read the bookmark collections of the user
+	scopeBookmarksWrite     = "bookmarks:write"     // Manage the bookmark collections of the user
+	scopeUsersRead          = "users:read"          // Read user profiles
+	scopeUsersWrite         = "users:write"         // Follow and unfollow users
+	scopeNotificationsRead  = "notifications:read"  // Read the notifications and mentions of the user
+	scopeNotificationsWrite = "notifications:write" // Mark the notifications of the user read
+)
+
+// apiKeyPrefix is prepended to every API key so that leaked keys are easy to recognize
+const apiKeyPrefix = "sk_"
+
+// apiKeyDisplayLength is the number of leading characters of a key stored in clear to tell keys apart
+const apiKeyDisplayLength = len(apiKeyPrefix) + 8
+
+// CreateAPIKeyPayload defines the structure for the payload when creating an API key
+type CreateAPIKeyPayload struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write comments:write reactions:write feed:read bookmarks:read bookmarks:write users:read users:write notifications:read notifications:write"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"` // Omit for a key that never expires
+}
+
+// APIKeyWithSecret is returned when an API key is created, the only time its secret is shown
+type APIKeyWithSecret struct {
+	*store.APIKey
+	Key string `json:"key"`
+}
+
+// createAPIKeyHandler creates a new API key for the authenticated user.
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateAPIKeyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	plainKey := apiKeyPrefix + secret
+
+	user := app.getUserFromContext(r)
+
+	slices.Sort(payload.Scopes)
+	key := &store.APIKey{
+		UserID: user.ID,
+		Name:   payload.Name,
+		Prefix: plainKey[:apiKeyDisplayLength],
+		Scopes: slices.Compact(payload.Scopes),
+	}
+
+	exp := time.Duration(payload.ExpiresInDays) * 24 * time.Hour
+	if err := app.store.APIKeys.Create(r.Context(), key, hashToken(plainKey), exp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditAPIKeyCreate, store.AuditTargetAPIKey, key.ID, nil, key)
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, &APIKeyWithSecret{APIKey: key, Key: plainKey}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getAPIKeysHandler lists the API keys of the authenticated user, without their secrets.
+func (app *application) getAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromContext(r)
+
+	keys, err := app.store.APIKeys.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, keys); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteAPIKeyHandler revokes an API key of the authenticated user.
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getUserFromContext(r)
+
+	if err := app.store.APIKeys.Delete(r.Context(), keyID, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditAPIKeyDelete, store.AuditTargetAPIKey, keyID, nil, nil)
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getAPIKeyFromContext retrieves the API key the request was authenticated with, or nil for an access token.
+func (app *application) getAPIKeyFromContext(r *http.Request) *store.APIKey {
+	key, _ := r.Context().Value("apiKey").(*store.APIKey)
+
+	return key
+}
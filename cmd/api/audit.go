@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Actions recorded in the audit trail
+const (
+	auditLogin          = "auth.login"
+	auditLoginFailed    = "auth.login.failed"
+	auditLockout        = "auth.lockout"
+	auditUserActivate   = "user.activate"
+	auditUserUnlock     = "user.unlock"
+	auditPostUpdate     = "post.update"
+	auditPostDelete     = "post.delete"
+	auditPostRestore    = "post.restore"
+	auditAPIKeyCreate   = "api_key.create"
+	auditAPIKeyDelete   = "api_key.delete"
+	auditRoleCreate     = "role.create"
+	auditRoleUpdate     = "role.update"
+	auditRoleDelete     = "role.delete"
+	auditUserRoleAssign = "user.role.assign"
+	auditUserRoleRemove = "user.role.remove"
+
+	auditUserImpersonate     = "user.impersonate"
+	auditImpersonatedRequest = "user.impersonate.request"
+)
+
+// auditExportLimit caps the number of events in a CSV export
+const auditExportLimit = 10000
+
+// auditChange holds the old and new value of a field changed by an action. Either is left out when the field did not
+// exist before or after, such as on creation or deletion.
+type auditChange struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+// auditDiff maps the JSON names of the fields changed by an action to their change.
+type auditDiff map[string]auditChange
+
+// newAuditDiff compares the JSON forms of a resource before and after an action and returns the fields that differ.
+// Pass nil as before for a creation, and as after for a deletion.
+func newAuditDiff(before, after any) (auditDiff, error) {
+	old, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := auditDiff{}
+	for name, value := range old {
+		if newValue, ok := current[name]; !ok || !reflect.DeepEqual(value, newValue) {
+			diff[name] = auditChange{Old: value, New: newValue}
+		}
+	}
+	for name, value := range current {
+		if _, ok := old[name]; !ok {
+			diff[name] = auditChange{New: value}
+		}
+	}
+
+	return diff, nil
+}
+
+// auditFields returns the fields of the JSON form of a value, which must encode to an object.
+func auditFields(v any) (map[string]any, error) {
+	fields := map[string]any{}
+	if v == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// audit records an action of the authenticated user in the audit trail. While a user is impersonated, the
+// administrator acting as them is recorded instead.
+func (app *application) audit(r *http.Request, action, targetType string, targetID any, before, after any) {
+	actor := app.getActorFromContext(r)
+	if actor == nil {
+		actor = app.getUserFromContext(r)
+	}
+
+	app.auditAs(r, actor, action, targetType, targetID, before, after)
+}
+
+// auditAs records an action in the audit trail on behalf of the given actor, for requests that are not authenticated
+// such as logins. The action is already taken, so a failure to record it is logged rather than failing the request.
+func (app *application) auditAs(r *http.Request, actor *store.User, action, targetType string, targetID any, before, after any) {
+	event := &store.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		RequestID:  middleware.GetReqID(r.Context()),
+		IP:         clientIP(r),
+	}
+
+	if actor != nil {
+		event.ActorID = &actor.ID
+	}
+
+	diff, err := newAuditDiff(before, after)
+	if err == nil {
+		event.Diff, err = json.Marshal(diff)
+	}
+	if err != nil {
+		app.logger.Errorw("Failed to encode audit event", "action", action, "error", err.Error())
+		return
+	}
+
+	if err := app.store.Audit.Create(r.Context(), event); err != nil {
+		app.logger.Errorw("Failed to record audit event", "action", action, "target", event.TargetID, "error", err.Error())
+	}
+}
+
+// getAuditEventsHandler lists the audit events matching the filters of the query string, newest first.
+func (app *application) getAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := app.parseAuditQuery(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := app.store.Audit.List(r.Context(), q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, events); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// exportAuditEventsHandler exports the audit events matching the filters of the query string as CSV, newest first.
+func (app *application) exportAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := app.parseAuditQuery(w, r)
+	if !ok {
+		return
+	}
+
+	// Exports are not paginated, up to the export limit
+	q.Limit, q.Offset = auditExportLimit, 0
+
+	events, err := app.store.Audit.List(r.Context(), q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-events.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "request_id", "ip", "diff"})
+	for _, event := range events {
+		actorID := ""
+		if event.ActorID != nil {
+			actorID = strconv.FormatInt(*event.ActorID, 10)
+		}
+
+		cw.Write([]string{
+			strconv.FormatInt(event.ID, 10),
+			event.CreatedAt,
+			actorID,
+			csvSafe(event.Action),
+			csvSafe(event.TargetType),
+			csvSafe(event.TargetID),
+			csvSafe(event.RequestID),
+			csvSafe(event.IP),
+			csvSafe(string(event.Diff)),
+		})
+	}
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		app.logger.Errorw("Failed to write audit export", "error", err.Error())
+	}
+}
+
+// parseAuditQuery parses and validates the audit filters of a request, writing the error response if they are invalid.
+func (app *application) parseAuditQuery(w http.ResponseWriter, r *http.Request) (store.AuditQuery, bool) {
+	q, err := store.AuditQuery{Limit: 50}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return q, false
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestError(w, r, err)
+		return q, false
+	}
+
+	return q, true
+}
+
+// csvSafe escapes values that spreadsheet applications would evaluate as formulas, as diffs hold user content.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
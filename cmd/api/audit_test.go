@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/NR3101/social/internal/store"
+)
+
+func TestAuditDiff(t *testing.T) {
+	t.Run("should only keep the changed fields", func(t *testing.T) {
+		before := &store.Role{ID: 4, Name: "editor", Level: 2, Permissions: []string{"post.update.any"}}
+		after := &store.Role{ID: 4, Name: "editor", Level: 3, Permissions: []string{"post.update.any"}}
+
+		diff, err := newAuditDiff(before, after)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(diff) != 1 {
+			t.Fatalf("expected only the level to change, got %v", diff)
+		}
+		if change := diff["level"]; change.Old != float64(2) || change.New != float64(3) {
+			t.Errorf("unexpected change of level %+v", change)
+		}
+	})
+
+	t.Run("should record every field on creation and deletion", func(t *testing.T) {
+		fields := map[string]any{"title": "Hello", "user_id": 1}
+
+		created, err := newAuditDiff(nil, fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(created) != 2 || created["title"].Old != nil || created["title"].New != "Hello" {
+			t.Errorf("unexpected creation diff %v", created)
+		}
+
+		deleted, err := newAuditDiff(fields, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deleted) != 2 || deleted["title"].Old != "Hello" || deleted["title"].New != nil {
+			t.Errorf("unexpected deletion diff %v", deleted)
+		}
+	})
+}
+
+func TestCSVSafe(t *testing.T) {
+	cases := map[string]string{
+		"auth.login":          "auth.login",
+		"=HYPERLINK(\"x\")":   "'=HYPERLINK(\"x\")",
+		"+1":                  "'+1",
+		"@SUM(A1)":            "'@SUM(A1)",
+		`{"title":{"new":1}}`: `{"title":{"new":1}}`,
+	}
+
+	for value, expected := range cases {
+		if got := csvSafe(value); got != expected {
+			t.Errorf("csvSafe(%q) = %q, expected %q", value, got, expected)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -10,6 +13,7 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/NR3101/social/internal/store"
 )
@@ -27,11 +31,33 @@ type UserWithToken struct {
 	Token string `json:"token"` // Token for user activation or invitation
 }
 
+// dummyPasswordHash is compared against when the email is unknown, so that the response time does not tell whether
+// an account exists. It has the cost of the hashes of user passwords.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// compareDummyPassword spends the time of a password check on a login for an unknown email.
+var compareDummyPassword = func(password string) {
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
 type CreateUserTokenPayload struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 
+// RefreshTokenPayload defines the structure for the refresh and logout payloads
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// TokenResponse is returned when a user logs in or refreshes their tokens
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`  // Short-lived JWT used to authenticate requests
+	RefreshToken string `json:"refresh_token"` // Single-use token used to get a new token pair
+	TokenType    string `json:"token_type"`    // Scheme to use in the Authorization header
+	ExpiresIn    int64  `json:"expires_in"`    // Lifetime of the access token in seconds
+}
+
 // registerUserHandler handles user registration requests
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	var payload RegisterUserPayload
@@ -67,10 +93,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	plainToken := uuid.New().String() // Generate a new UUID token for invitation
 
 	// hash the token for security
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
-
-	if err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp); err != nil {
+	if err := app.store.Users.CreateAndInvite(ctx, user, hashToken(plainToken), app.config.mail.exp); err != nil {
 		switch err {
 		case store.ErrDuplicateEmail:
 			app.badRequestError(w, r, err)
@@ -147,11 +170,31 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	// Add debug logging
 	app.logger.Infow("Authentication attempt", "email", payload.Email)
 
+	// Reject the attempt if the account or the client is locked out after too many failures
+	ctx := r.Context()
+	retryAfter, err := app.checkLoginLockout(ctx, r, payload.Email)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.accountLockedError(w, r, retryAfter)
+		return
+	}
+
 	// Check if the user exists
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
 	if err != nil {
 		app.logger.Errorw("User lookup failed", "email", payload.Email, "error", err)
 		if errors.Is(err, store.ErrNotFound) {
+			// Check the password and count failures for unknown emails too, so that neither the response nor its
+			// timing tells whether an account exists
+			compareDummyPassword(payload.Password)
+			if err := app.recordLoginFailure(ctx, r, payload.Email, nil); err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
 			app.unauthorizedError(w, r, fmt.Errorf("invalid credentials"))
 		} else {
 			app.internalServerError(w, r, err)
@@ -165,29 +208,153 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	// Verify the password is correct
 	if err := user.Password.Compare(payload.Password); err != nil {
 		app.logger.Errorw("Password comparison failed", "userID", user.ID, "error", err)
+		if err := app.recordLoginFailure(ctx, r, payload.Email, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
 		app.unauthorizedError(w, r, fmt.Errorf("invalid credentials"))
 		return
 	}
 
 	app.logger.Infow("Authentication successful", "userID", user.ID)
 
-	// Generate the token with claims
-	claims := jwt.MapClaims{
-		"sub": user.ID,                                          // Subject (user ID)
-		"exp": time.Now().Add(app.config.auth.token.exp).Unix(), // Expiration time
-		"iat": time.Now().Unix(),                                // Issued at time
-		"nbf": time.Now().Unix(),                                // Not before time
-		"iss": app.config.auth.token.iss,                        // Issuer
-		"aud": app.config.auth.token.iss,                        // Audience
+	// Ask for a second factor if needed, or start a new session
+	app.completeLogin(w, r, user)
+}
+
+// refreshTokenHandler exchanges a refresh token for a new access and refresh token pair
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	refreshToken, err := generateToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Rotate the refresh token, a reused token revokes the whole session
+	ctx := r.Context()
+	session, err := app.store.Sessions.Rotate(ctx, hashToken(payload.RefreshToken), hashToken(refreshToken), app.config.auth.token.refreshExp)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrTokenReused):
+			app.logger.Warnw("Refresh token reuse detected, session revoked", "error", err)
+			app.unauthorizedError(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.unauthorizedError(w, r, fmt.Errorf("invalid refresh token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
 	}
-	token, err := app.authenticator.GenerateToken(claims)
+
+	accessToken, err := app.generateAccessToken(session.UserID, session.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.writeJSONResponse(w, http.StatusCreated, token); err != nil {
+	tokens := &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, tokens); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
+
+// logoutHandler revokes the session of a refresh token, which also invalidates its access tokens
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Logging out of an unknown or already revoked session is not an error
+	if err := app.store.Sessions.RevokeByToken(r.Context(), hashToken(payload.RefreshToken)); err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// issueTokens starts a new session for the user and returns its access and refresh tokens
+func (app *application) issueTokens(ctx context.Context, user *store.User) (*TokenResponse, error) {
+	refreshToken, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &store.Session{UserID: user.ID}
+	if err := app.store.Sessions.Create(ctx, session, hashToken(refreshToken), app.config.auth.token.refreshExp); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := app.generateAccessToken(user.ID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}, nil
+}
+
+// generateAccessToken generates a short-lived JWT for a user, bound to one of their sessions
+func (app *application) generateAccessToken(userID int64, sessionID string) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,                                           // Subject (user ID)
+		"sid": sessionID,                                        // Session the token belongs to
+		"exp": time.Now().Add(app.config.auth.token.exp).Unix(), // Expiration time
+		"iat": time.Now().Unix(),                                // Issued at time
+		"nbf": time.Now().Unix(),                                // Not before time
+		"iss": app.config.auth.token.iss,                        // Issuer
+		"aud": app.config.auth.token.iss,                        // Audience
+	}
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+// generateToken generates a random URL-safe token
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes a token with SHA-256 so that only its hash is ever stored
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
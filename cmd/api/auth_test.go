@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/NR3101/social/internal/store"
+)
+
+// unknownUserStoreStub knows no user by email
+type unknownUserStoreStub struct {
+	*store.MockUserStore
+}
+
+func (s *unknownUserStoreStub) GetByEmail(ctx context.Context, email string) (*store.User, error) {
+	return nil, store.ErrNotFound
+}
+
+// revokedSessionStoreStub serves sessions that have all been revoked
+type revokedSessionStoreStub struct {
+	*store.MockSessionStore
+}
+
+func (s *revokedSessionStoreStub) GetByID(ctx context.Context, id string) (*store.Session, error) {
+	revokedAt := time.Now().Format(time.RFC3339)
+	return &store.Session{ID: id, RevokedAt: &revokedAt}, nil
+}
+
+func TestRefreshToken(t *testing.T) {
+	const sessionID = "6f1c2d3e-4b5a-4c7d-8e9f-0a1b2c3d4e5f"
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	app := newTestApplication(t)
+	app.config.auth.token.refreshExp = time.Hour
+	app.store.Sessions = store.NewStorage(db).Sessions
+	mux := app.mount()
+
+	// refresh presents a refresh token whose row in the database was last used at usedAt, nil if never, and sets
+	// the expectations for the rest of the rotation with expect
+	refresh := func(t *testing.T, usedAt *time.Time, expect func()) int {
+		t.Helper()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT s.id, s.user_id, s.created_at, s.revoked_at, rt.expiry, rt.used_at`).
+			WithArgs(hashToken("refresh-token")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "created_at", "revoked_at", "expiry", "used_at"}).
+				AddRow(sessionID, 1, time.Now().Format(time.RFC3339), nil, time.Now().Add(time.Hour), usedAt))
+		expect()
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/refresh", strings.NewReader(`{"refresh_token": "refresh-token"}`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should rotate a refresh token once", func(t *testing.T) {
+		code := refresh(t, nil, func() {
+			mock.ExpectExec(`UPDATE refresh_tokens SET used_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO refresh_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		})
+		checkResponseCode(t, http.StatusCreated, code)
+	})
+
+	t.Run("should revoke the session when a rotated token is replayed", func(t *testing.T) {
+		usedAt := time.Now()
+		code := refresh(t, &usedAt, func() {
+			mock.ExpectExec(`UPDATE sessions SET revoked_at`).WithArgs(sessionID).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		})
+		checkResponseCode(t, http.StatusUnauthorized, code)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRevokedSession(t *testing.T) {
+	app := newTestApplication(t)
+	app.store.Sessions = &revokedSessionStoreStub{}
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	t.Run("should reject access tokens of a revoked session", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestCreateTokenUnknownEmail(t *testing.T) {
+	app := newTestApplication(t)
+	app.store.Users = &unknownUserStoreStub{}
+	mux := app.mount()
+
+	var compared []string
+	compare := compareDummyPassword
+	compareDummyPassword = func(password string) {
+		compared = append(compared, password)
+		compare(password)
+	}
+	defer func() { compareDummyPassword = compare }()
+
+	t.Run("should check the password of unknown emails like that of known ones", func(t *testing.T) {
+		body := `{"email": "nobody@example.com", "password": "guess"}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+		if len(compared) != 1 || compared[0] != "guess" {
+			t.Errorf("expected the password to be compared against the dummy hash once, got %q", compared)
+		}
+	})
+}
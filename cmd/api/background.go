@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+)
+
+// background runs a function in a new goroutine, recovering from any panic so that it cannot crash the server.
+// The server waits for background functions to finish before shutting down.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Errorw("background task panicked", "error", fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateBookmarkCollectionPayload represents the payload for creating a bookmark collection
+type CreateBookmarkCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// getBookmarkCollectionsHandler lists the bookmark collections of the authenticated user.
+func (app *application) getBookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromContext(r)
+
+	collections, err := app.store.Bookmarks.GetCollections(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// createBookmarkCollectionHandler creates an empty bookmark collection for the authenticated user.
+func (app *application) createBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBookmarkCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	collection := &store.BookmarkCollection{
+		UserID: app.getUserFromContext(r).ID,
+		Name:   payload.Name,
+	}
+
+	if err := app.store.Bookmarks.CreateCollection(r.Context(), collection); err != nil {
+		if errors.Is(err, store.ErrDuplicateCollection) {
+			app.conflictError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getBookmarkCollectionHandler lists a page of the posts saved in a collection, most recently saved first. It takes
+// the same filters as the feed.
+func (app *application) getBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,     // Default limit for pagination
+		Offset: 0,      // Default offset for pagination
+		Sort:   "desc", // Default sort order
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	collection := app.getBookmarkCollectionFromContext(r)
+	posts, err := app.store.Bookmarks.GetPosts(r.Context(), collection.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Posts.LoadOriginals(r.Context(), collection.UserID, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadMedia(r.Context(), posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostMentions(r.Context(), posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	response := struct {
+		*store.BookmarkCollection
+		Posts []*store.Post `json:"posts"`
+	}{collection, posts}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteBookmarkCollectionHandler deletes a bookmark collection with its bookmarks. The posts are left untouched.
+func (app *application) deleteBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := app.getBookmarkCollectionFromContext(r)
+
+	if err := app.store.Bookmarks.DeleteCollection(r.Context(), collection.ID, collection.UserID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// addBookmarkHandler saves a post in a collection. Posts the user cannot see are reported as not found, as in
+// postsContextMiddleware. Saving a post twice does nothing.
+func (app *application) addBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	post, err := app.store.Posts.GetByID(ctx, chi.URLParam(r, "postID"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	visible, err := app.canViewPost(ctx, app.getUserFromContext(r), post)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !visible {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	collection := app.getBookmarkCollectionFromContext(r)
+	if err := app.store.Bookmarks.Add(ctx, collection.ID, post.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// removeBookmarkHandler takes a post out of a collection.
+func (app *application) removeBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	collection := app.getBookmarkCollectionFromContext(r)
+	if err := app.store.Bookmarks.Remove(r.Context(), collection.ID, postID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// bookmarkCollectionsContextMiddleware loads the collection of the URL, which must belong to the authenticated
+// user. Collections of other users are reported as not found.
+func (app *application) bookmarkCollectionsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collectionID, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		user := app.getUserFromContext(r)
+		collection, err := app.store.Bookmarks.GetCollection(ctx, collectionID, user.ID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.notFoundError(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// Store the collection in the context for use in subsequent handlers
+		ctx = context.WithValue(ctx, "bookmarkCollection", collection)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// getBookmarkCollectionFromContext retrieves the bookmark collection from the request context.
+func (app *application) getBookmarkCollectionFromContext(r *http.Request) *store.BookmarkCollection {
+	collection, _ := r.Context().Value("bookmarkCollection").(*store.BookmarkCollection)
+
+	return collection
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// bookmarkStoreStub records the posts saved in collections
+type bookmarkStoreStub struct {
+	*store.BookmarkStore
+	saved []int64
+}
+
+func (s *bookmarkStoreStub) Add(ctx context.Context, collectionID, postID int64) error {
+	s.saved = append(s.saved, postID)
+	return nil
+}
+
+func TestAddBookmark(t *testing.T) {
+	const authorID, viewerID = 1, 2
+
+	app := newTestApplication(t)
+	app.store.Followers = &followerStoreStub{}
+	bookmarks := &bookmarkStoreStub{}
+	app.store.Bookmarks = bookmarks
+
+	// addBookmark saves a post of the author in a collection of the viewer
+	addBookmark := func(t *testing.T, post *store.Post) int {
+		t.Helper()
+
+		app.store.Posts = &postStoreStub{post: post}
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/bookmarks/collections/1/posts/1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("postID", "1")
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+		ctx = context.WithValue(ctx, "user", &store.User{ID: viewerID})
+		ctx = context.WithValue(ctx, "bookmarkCollection", &store.BookmarkCollection{ID: 1, UserID: viewerID})
+
+		return executeRequest(req.WithContext(ctx), http.HandlerFunc(app.addBookmarkHandler)).Code
+	}
+
+	t.Run("should not save posts the user cannot see", func(t *testing.T) {
+		hidden := []*store.Post{
+			{ID: 1, UserID: authorID, Visibility: store.PostVisibilityPrivate, Status: store.PostStatusPublished},
+			{ID: 1, UserID: authorID, Visibility: store.PostVisibilityPublic, Status: store.PostStatusDraft},
+		}
+		for _, post := range hidden {
+			checkResponseCode(t, http.StatusNotFound, addBookmark(t, post))
+		}
+		if len(bookmarks.saved) != 0 {
+			t.Errorf("expected no posts saved, got %v", bookmarks.saved)
+		}
+	})
+
+	t.Run("should save posts the user can see", func(t *testing.T) {
+		post := &store.Post{ID: 1, UserID: authorID, Visibility: store.PostVisibilityPublic, Status: store.PostStatusPublished}
+		checkResponseCode(t, http.StatusNoContent, addBookmark(t, post))
+		if len(bookmarks.saved) != 1 {
+			t.Errorf("expected the post saved, got %v", bookmarks.saved)
+		}
+	})
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateCommentPayload represents the payload for creating a new comment
+type CreateCommentPayload struct {
+	Content  string `json:"content" validate:"required,max=1000"`
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gte=1"` // ID of the comment being replied to, if any
+}
+
+// UpdateCommentPayload represents the payload for updating an existing comment
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// CommentThreadsResponse represents a page of threaded comments
+type CommentThreadsResponse struct {
+	Comments   []*store.Comment `json:"comments"`
+	NextCursor string           `json:"next_cursor,omitempty"` // Cursor for the next page, empty on the last page
+}
+
+// createCommentHandler handles the creation of a new comment on a post.
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getUserFromContext(r)
+	post := app.getPostFromContext(r)
+	comment := &store.Comment{
+		PostID:   post.ID,
+		UserID:   user.ID,
+		ParentID: payload.ParentID,
+		Content:  payload.Content,
+		User: store.CommentUser{
+			ID:       user.ID,
+			Username: user.Username,
+		},
+	}
+
+	ctx := r.Context()
+
+	// A reply must be made to a comment on the same post
+	if payload.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(ctx, *payload.ParentID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if parent == nil || parent.PostID != post.ID || parent.Deleted {
+			app.badRequestError(w, r, errors.New("parent comment not found on this post"))
+			return
+		}
+	}
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getCommentsHandler handles the retrieval of a paginated list of comments for a post.
+func (app *application) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,     // Default limit for pagination
+		Offset: 0,      // Default offset for pagination
+		Sort:   "desc", // Default sort order
+	}
+
+	// Parse pagination parameters from the request
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the pagination parameters
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	post := app.getPostFromContext(r)
+	comments, err := app.store.Comments.ListByPostID(r.Context(), post.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadCommentMentions(r.Context(), comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getCommentThreadsHandler handles the retrieval of a page of comment threads for a post.
+func (app *application) getCommentThreadsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := app.parseCommentThreadQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	post := app.getPostFromContext(r)
+	comments, cursor, err := app.store.Comments.GetThreads(r.Context(), post.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadCommentMentions(r.Context(), comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, CommentThreadsResponse{Comments: comments, NextCursor: cursor}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getCommentRepliesHandler handles the retrieval of a page of replies to a specific comment.
+func (app *application) getCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := app.parseCommentThreadQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	comment := app.getCommentFromContext(r)
+	replies, cursor, err := app.store.Comments.GetReplies(r.Context(), comment.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadCommentMentions(r.Context(), replies); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, CommentThreadsResponse{Comments: replies, NextCursor: cursor}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// parseCommentThreadQuery parses and validates the thread parameters of the request, falling back to the defaults
+// used for the threads embedded in a post.
+func (app *application) parseCommentThreadQuery(r *http.Request) (store.CommentThreadQuery, error) {
+	q := store.CommentThreadQuery{
+		Limit:        postThreadsLimit,
+		MaxDepth:     postThreadsDepth,
+		RepliesLimit: postThreadsReplyLimit,
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		return q, err
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+// updateCommentHandler handles the update of a specific comment by ID.
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := app.getCommentFromContext(r)
+	if comment.Deleted {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	ctx := r.Context()
+	if err := app.store.Comments.Update(ctx, comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrCommentConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteCommentHandler handles the deletion of a specific comment by ID. A comment with replies is left in the thread
+// as a tombstone.
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := app.getCommentFromContext(r)
+	if comment.Deleted {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.store.Comments.Delete(ctx, comment.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.writeJSONResponse(w, http.StatusOK, map[string]any{
+		"commentID": comment.ID,
+		"message":   "Comment deleted successfully",
+	})
+}
+
+// commentsContextMiddleware is a middleware that retrieves a comment by its ID from the URL and makes sure it
+// belongs to the post already loaded into the request context.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		comment, err := app.store.Comments.GetByID(ctx, commentID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.notFoundError(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// A comment is only reachable through the post it was written on
+		post := app.getPostFromContext(r)
+		if comment.PostID != post.ID {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
+		// Store the comment in the context for use in subsequent handlers
+		ctx = context.WithValue(ctx, "comment", comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkCommentOwnership is an authorization middleware that checks if the user is the owner of a comment, or holds
+// the permission to act on the comments of other users.
+func (app *application) checkCommentOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.getUserFromContext(r)
+		comment := app.getCommentFromContext(r)
+
+		// check if the user is the owner of the comment
+		if user.ID == comment.UserID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// check if the user has the required permission to access the resource
+		allowed, err := app.hasPermission(r.Context(), user, permission)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenError(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// getCommentFromContext retrieves the comment from the request context.
+func (app *application) getCommentFromContext(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value("comment").(*store.Comment)
+
+	return comment
+}
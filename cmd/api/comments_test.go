@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// commentStoreStub serves a single comment, and fails its updates as concurrent edits when conflict is set
+type commentStoreStub struct {
+	*store.CommentStore
+	comment  *store.Comment
+	conflict bool
+	deleted  bool
+}
+
+func (s *commentStoreStub) GetByID(ctx context.Context, commentID int64) (*store.Comment, error) {
+	if commentID != s.comment.ID {
+		return nil, store.ErrNotFound
+	}
+	comment := *s.comment
+	return &comment, nil
+}
+
+func (s *commentStoreStub) Update(ctx context.Context, comment *store.Comment) error {
+	if s.conflict {
+		return store.ErrCommentConflict
+	}
+	comment.Version++
+	return nil
+}
+
+func (s *commentStoreStub) Delete(ctx context.Context, commentID int64) error {
+	s.deleted = true
+	return nil
+}
+
+func TestCommentOwnership(t *testing.T) {
+	const authorID, viewerID = 1, 2
+
+	app := newTestApplication(t)
+	comments := &commentStoreStub{comment: &store.Comment{ID: 5, PostID: 1, UserID: authorID, Content: "first", Version: 1}}
+	app.store.Comments = comments
+	roles := &roleStoreStub{}
+	app.store.Roles = roles
+
+	// request sends a request for a comment of a post as a user to the handler of the comment route
+	request := func(t *testing.T, method, commentID string, postID, userID int64, handler http.HandlerFunc) int {
+		t.Helper()
+
+		req, err := http.NewRequest(method, "/v1/posts/1/comments/"+commentID, strings.NewReader(`{"content": "edited"}`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("commentID", commentID)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+		ctx = context.WithValue(ctx, "user", &store.User{ID: userID})
+		ctx = context.WithValue(ctx, "post", &store.Post{ID: postID})
+
+		return executeRequest(req.WithContext(ctx), app.commentsContextMiddleware(handler)).Code
+	}
+
+	update := app.checkCommentOwnership(permCommentModerate, app.updateCommentHandler)
+	remove := app.checkCommentOwnership(permCommentDeleteAny, app.deleteCommentHandler)
+
+	t.Run("should let the author update and delete their comment", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodPatch, "5", 1, authorID, update))
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodDelete, "5", 1, authorID, remove))
+	})
+
+	t.Run("should not let other users update or delete the comment", func(t *testing.T) {
+		comments.deleted = false
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodPatch, "5", 1, viewerID, update))
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodDelete, "5", 1, viewerID, remove))
+		if comments.deleted {
+			t.Error("expected the comment not to be deleted")
+		}
+	})
+
+	t.Run("should let moderators update and delete the comment", func(t *testing.T) {
+		roles.permissions = []string{permCommentModerate}
+		defer func() { roles.permissions = nil }()
+
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodPatch, "5", 1, viewerID, update))
+		checkResponseCode(t, http.StatusForbidden, request(t, http.MethodDelete, "5", 1, viewerID, remove))
+
+		roles.permissions = []string{permCommentDeleteAny}
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodDelete, "5", 1, viewerID, remove))
+	})
+
+	t.Run("should only reach a comment through its post", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodPatch, "5", 2, authorID, update))
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodDelete, "5", 2, authorID, remove))
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodPatch, "6", 1, authorID, update))
+		checkResponseCode(t, http.StatusBadRequest, request(t, http.MethodPatch, "abc", 1, authorID, update))
+	})
+
+	t.Run("should report concurrent edits as conflicts", func(t *testing.T) {
+		comments.conflict = true
+		defer func() { comments.conflict = false }()
+
+		checkResponseCode(t, http.StatusConflict, request(t, http.MethodPatch, "5", 1, authorID, update))
+	})
+
+	t.Run("should not update or delete deleted comments", func(t *testing.T) {
+		comments.comment.Deleted = true
+		defer func() { comments.comment.Deleted = false }()
+
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodPatch, "5", 1, authorID, update))
+		checkResponseCode(t, http.StatusNotFound, request(t, http.MethodDelete, "5", 1, authorID, remove))
+	})
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // This file contains error handling functions for the application.
@@ -27,6 +30,13 @@ func (app *application) notFoundError(w http.ResponseWriter, r *http.Request, er
 	writeJSONError(w, http.StatusNotFound, "the requested resource could not be found")
 }
 
+// conflictError handles requests that conflict with the current state of a resource and writes a JSON response.
+func (app *application) conflictError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Errorw("conflict error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusConflict, err.Error())
+}
+
 // unauthorizedError handles unauthorized errors and writes a JSON response.
 func (app *application) unauthorizedError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Errorw("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
@@ -60,3 +70,28 @@ func (app *application) rateLimitExceededError(w http.ResponseWriter, r *http.Re
 
 	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, please try again after "+retryAfter)
 }
+
+// accountLockedError handles logins rejected because of too many failed attempts and writes a JSON response.
+func (app *application) accountLockedError(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	app.logger.Warnw("account locked error", "method", r.Method, "path", r.URL.Path)
+
+	// Set the Retry-After header to the number of seconds until the lock ends, rounded up
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	w.Header().Set("Retry-After", seconds)
+
+	writeJSONError(w, http.StatusTooManyRequests, "too many failed login attempts, please try again after "+seconds+" seconds")
+}
+
+// payloadTooLargeError handles request bodies over the size limit of an endpoint and writes a JSON response.
+func (app *application) payloadTooLargeError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Errorw("payload too large error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+// unsupportedMediaTypeError handles uploads of files of a type the endpoint does not accept and writes a JSON response.
+func (app *application) unsupportedMediaTypeError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Errorw("unsupported media type error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
@@ -28,13 +28,27 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	ctx := r.Context()
+	user := app.getUserFromContext(r)
 
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(137), fq)
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	posts := make([]*store.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+	if err := app.loadMedia(ctx, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.loadPostMentions(ctx, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	if err := app.writeJSONResponse(w, http.StatusOK, feed); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ImpersonatePayload represents the payload for impersonating a user
+type ImpersonatePayload struct {
+	Reason string `json:"reason" validate:"required,max=255"` // Why the user is impersonated, kept in the audit trail
+}
+
+// ImpersonationResponse holds a token to act as another user. It cannot be refreshed.
+type ImpersonationResponse struct {
+	AccessToken string `json:"access_token"` // Short-lived JWT used to authenticate requests as the user
+	TokenType   string `json:"token_type"`   // Scheme to use in the Authorization header
+	ExpiresIn   int64  `json:"expires_in"`   // Lifetime of the access token in seconds
+	UserID      int64  `json:"user_id"`      // ID of the impersonated user
+}
+
+// impersonateUserHandler lets an administrator mint a short-lived token to act as another user. The token is bound
+// to the administrator's session and names them in its act claim, so that they remain accountable for its use.
+func (app *application) impersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var payload ImpersonatePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	actor := app.getUserFromContext(r)
+	if userID == actor.ID {
+		app.badRequestError(w, r, fmt.Errorf("cannot impersonate yourself"))
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetByID(ctx, strconv.FormatInt(userID, 10))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Administrators cannot act as each other, so that impersonation never grants more than the actor holds
+	privileged, err := app.hasPermission(ctx, user, permUserImpersonate)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if privileged {
+		app.forbiddenError(w, r)
+		return
+	}
+
+	session := app.getSessionFromContext(r)
+	exp := app.config.auth.token.impersonationExp
+
+	token, err := app.generateImpersonationToken(user.ID, actor.ID, session.ID, exp)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Warnw("User impersonated", "userID", user.ID, "by", actor.ID)
+	app.audit(r, auditUserImpersonate, store.AuditTargetUser, user.ID, nil, map[string]any{
+		"reason":     payload.Reason,
+		"expires_in": exp.String(),
+	})
+
+	response := &ImpersonationResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(exp.Seconds()),
+		UserID:      user.ID,
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// generateImpersonationToken generates a JWT to act as a user on behalf of an administrator, bound to one of the
+// administrator's sessions
+func (app *application) generateImpersonationToken(userID, actorID int64, sessionID string, exp time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,                         // Subject (impersonated user ID)
+		"act": map[string]any{"sub": actorID}, // Actor (administrator ID), as in RFC 8693
+		"sid": sessionID,                      // Session of the administrator the token belongs to
+		"exp": time.Now().Add(exp).Unix(),     // Expiration time
+		"iat": time.Now().Unix(),              // Issued at time
+		"nbf": time.Now().Unix(),              // Not before time
+		"iss": app.config.auth.token.iss,      // Issuer
+		"aud": app.config.auth.token.iss,      // Audience
+	}
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+// authenticateActor returns the administrator named in the act claim of an impersonation token. They must own the
+// session of the token and still be allowed to impersonate users.
+func (app *application) authenticateActor(ctx context.Context, act any, session *store.Session) (*store.User, error) {
+	claim, ok := act.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid act claim")
+	}
+
+	actorID, err := strconv.ParseInt(fmt.Sprintf("%.f", claim["sub"]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid act claim")
+	}
+
+	if session.UserID != actorID {
+		return nil, fmt.Errorf("session does not belong to the actor")
+	}
+
+	actor, err := app.getUser(ctx, strconv.FormatInt(actorID, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := app.hasPermission(ctx, actor, permUserImpersonate)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("actor is no longer allowed to impersonate users")
+	}
+
+	return actor, nil
+}
+
+// denyImpersonation is a middleware that rejects requests made while impersonating a user, for sensitive actions
+// such as managing credentials or administration.
+func (app *application) denyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.getActorFromContext(r) != nil {
+			app.forbiddenError(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getActorFromContext returns the administrator impersonating the user of the request, nil if there is none.
+func (app *application) getActorFromContext(r *http.Request) *store.User {
+	actor, _ := r.Context().Value("actor").(*store.User)
+
+	return actor
+}
+
+// getSessionFromContext returns the session of the access token of the request, nil for API keys.
+func (app *application) getSessionFromContext(r *http.Request) *store.Session {
+	session, _ := r.Context().Value("session").(*store.Session)
+
+	return session
+}
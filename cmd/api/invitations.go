@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/NR3101/social/internal/mailer"
+	"github.com/NR3101/social/internal/store"
+)
+
+// ResendActivationPayload defines the structure for the payload when resending an activation email
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// resendActivationHandler replaces the invitation of a user who has not activated their account yet and emails them
+// the new activation link. It responds the same way whether or not such a user exists, so it cannot be used to find
+// out who is registered.
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	plainToken, err := generateToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.RotateInvitation(r.Context(), payload.Email, hashToken(plainToken), app.config.mail.exp)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if user != nil {
+		// email variables
+		isProdEnv := app.config.env == "production"
+		vars := struct {
+			Username      string
+			ActivationURL string
+		}{
+			Username:      user.Username,
+			ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken),
+		}
+
+		// Send the email in the background so the response time does not depend on whether the account exists
+		app.background(func() {
+			if _, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+				app.logger.Errorw("failed to resend activation email", "error", err, "userID", user.ID)
+			}
+		})
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusAccepted, map[string]string{
+		"message": "if an account awaiting activation exists for this email, a new activation link has been sent to it",
+	}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getInvitationsHandler lists the users who have not activated their account yet, for administrators.
+func (app *application) getInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,     // Default limit for pagination
+		Offset: 0,      // Default offset for pagination
+		Sort:   "desc", // Default sort order
+	}
+
+	// Parse pagination parameters from the request
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the pagination parameters
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	invitations, err := app.store.Users.GetPendingInvitations(r.Context(), fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, invitations); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
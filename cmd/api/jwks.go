@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+)
+
+// jwksHandler serves the public keys tokens are signed with, as a JSON Web Key Set. The set is served without the
+// data envelope, as verifiers expect it.
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	// Let verifiers cache the keys, a rotation publishes the new key well before it is used
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := writeJSON(w, http.StatusOK, app.authenticator.JWKS()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
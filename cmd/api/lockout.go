@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NR3101/social/internal/mailer"
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// lockDuration returns how long a key is locked after the given number of consecutive failures, backing off
+// exponentially once the threshold is reached.
+func (c lockoutConfig) lockDuration(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	d := c.baseLock
+	for i := threshold; i < failures && d < c.maxLock; i++ {
+		d *= 2
+	}
+
+	return min(d, c.maxLock)
+}
+
+// checkLoginLockout returns how long logins for the email from the client of the request are still locked, or zero
+// if they are not.
+func (app *application) checkLoginLockout(ctx context.Context, r *http.Request, email string) (time.Duration, error) {
+	var retryAfter time.Duration
+
+	for kind, key := range loginFailureKeys(r, email) {
+		lockedUntil, err := app.store.LoginFailures.GetLockedUntil(ctx, kind, key)
+		if err != nil {
+			return 0, err
+		}
+
+		if lockedUntil != nil {
+			retryAfter = max(retryAfter, time.Until(*lockedUntil))
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// recordLoginFailure counts a failed login for the email and the client of the request, and locks them once they
+// reach their threshold. The user, if the email belongs to one, is told by email when their account gets locked.
+func (app *application) recordLoginFailure(ctx context.Context, r *http.Request, email string, user *store.User) error {
+	cfg := app.config.auth.lockout
+
+	if user != nil {
+		app.auditAs(r, nil, auditLoginFailed, store.AuditTargetUser, user.ID, nil, nil)
+	}
+
+	for kind, key := range loginFailureKeys(r, email) {
+		failures, err := app.store.LoginFailures.RecordFailure(ctx, kind, key, cfg.window)
+		if err != nil {
+			return err
+		}
+
+		threshold := cfg.accountThreshold
+		if kind == store.LoginFailureIP {
+			threshold = cfg.ipThreshold
+		}
+
+		d := cfg.lockDuration(failures, threshold)
+		if d == 0 {
+			continue
+		}
+
+		if err := app.store.LoginFailures.Lock(ctx, kind, key, d); err != nil {
+			return err
+		}
+
+		app.logger.Warnw("Login locked", "kind", kind, "key", key, "failures", failures, "duration", d.String())
+
+		if kind == store.LoginFailureAccount && user != nil {
+			app.auditAs(r, nil, auditLockout, store.AuditTargetUser, user.ID, nil, map[string]any{"duration": d.String()})
+		}
+
+		// Only the first lock is worth an email, the following ones are part of the same attack
+		if kind == store.LoginFailureAccount && failures == threshold && user != nil {
+			app.sendAccountLockedEmail(user, d)
+		}
+	}
+
+	return nil
+}
+
+// resetLoginFailures clears the failed logins of an email after a successful login. Failures from the IP address are
+// kept, so that an attacker cannot clear them by logging into an account of their own.
+func (app *application) resetLoginFailures(ctx context.Context, email string) error {
+	return app.store.LoginFailures.Reset(ctx, store.LoginFailureAccount, normalizeEmail(email))
+}
+
+// sendAccountLockedEmail tells a user in the background that their account got locked.
+func (app *application) sendAccountLockedEmail(user *store.User, d time.Duration) {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username     string
+		LockedFor    string
+		ResetURL     string
+		SupportEmail string
+	}{
+		Username:     user.Username,
+		LockedFor:    d.String(),
+		ResetURL:     app.config.frontendURL + "/forgot-password",
+		SupportEmail: app.config.mail.fromEmail,
+	}
+
+	app.background(func() {
+		if _, err := app.mailer.Send(mailer.AccountLockedTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+			app.logger.Errorw("failed to send account locked email", "error", err, "userID", user.ID)
+		}
+	})
+}
+
+// unlockUserHandler lets an administrator clear the failed logins and lock of a user's account.
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetByID(ctx, strconv.FormatInt(userID, 10))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.resetLoginFailures(ctx, user.Email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Infow("Account unlocked", "userID", user.ID, "by", app.getUserFromContext(r).ID)
+	app.audit(r, auditUserUnlock, store.AuditTargetUser, user.ID, nil, nil)
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// loginFailureKeys returns the keys failed logins for the email from the client of the request are counted by.
+func loginFailureKeys(r *http.Request, email string) map[string]string {
+	return map[string]string{
+		store.LoginFailureAccount: normalizeEmail(email),
+		store.LoginFailureIP:      clientIP(r),
+	}
+}
+
+// normalizeEmail lowercases an email so that case variants share their failed logins.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP returns the IP address of the client, as set by the realIP middleware.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
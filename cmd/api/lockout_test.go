@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/NR3101/social/internal/store"
+)
+
+func TestLoginFailureKeys(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.trustedProxies = []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")}
+
+	// ipKey returns the key failed logins of a request from a peer address are counted by for its IP address
+	ipKey := func(t *testing.T, peer, forwardedFor string) string {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.RemoteAddr = peer
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+
+		var key string
+		app.realIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key = loginFailureKeys(r, "user@example.com")[store.LoginFailureIP]
+		})).ServeHTTP(nil, req)
+
+		return key
+	}
+
+	t.Run("should count failures by peer address whatever the client forwards", func(t *testing.T) {
+		for _, forwardedFor := range []string{"198.51.100.1", "198.51.100.2", "10.0.0.1, 198.51.100.3"} {
+			if got := ipKey(t, "203.0.113.9:51000", forwardedFor); got != "203.0.113.9" {
+				t.Errorf("expected failures counted for 203.0.113.9, got %q", got)
+			}
+		}
+	})
+
+	t.Run("should count failures by the client address trusted proxies forward", func(t *testing.T) {
+		if got := ipKey(t, "192.168.1.2:443", "198.51.100.1, 203.0.113.9"); got != "203.0.113.9" {
+			t.Errorf("expected failures counted for 203.0.113.9, got %q", got)
+		}
+	})
+}
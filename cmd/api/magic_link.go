@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NR3101/social/internal/mailer"
+	"github.com/NR3101/social/internal/store"
+)
+
+// MagicLinkPayload defines the structure for the payload when requesting a sign-in link
+type MagicLinkPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// VerifyMagicLinkPayload defines the structure for the payload when logging in with a sign-in link
+type VerifyMagicLinkPayload struct {
+	Token string `json:"token" validate:"required,max=64"`
+}
+
+// requestMagicLinkHandler emails a single-use sign-in link to the user with the given email. It responds the same
+// way whether or not an account exists for the email, so it cannot be used to find out who is registered.
+func (app *application) requestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MagicLinkPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if user != nil {
+		plainToken, err := generateToken()
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// Remember who asked for the link, so that it can be bound to them
+		link := &store.LoginLink{
+			UserID:    user.ID,
+			IP:        clientIP(r),
+			UserAgent: r.UserAgent(),
+		}
+
+		cfg := app.config.auth.magicLink
+		if err := app.store.LoginLinks.Create(ctx, link, hashToken(plainToken), cfg.exp); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// email variables
+		isProdEnv := app.config.env == "production"
+		vars := struct {
+			Username      string
+			LoginURL      string
+			ExpiresIn     string
+			BoundToDevice bool
+		}{
+			Username:      user.Username,
+			LoginURL:      fmt.Sprintf("%s/magic-link/%s", app.config.frontendURL, plainToken),
+			ExpiresIn:     cfg.exp.String(),
+			BoundToDevice: cfg.bindClient,
+		}
+
+		// Send the email in the background so the response time does not depend on whether the account exists
+		app.background(func() {
+			if _, err := app.mailer.Send(mailer.MagicLinkTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+				app.logger.Errorw("failed to send sign-in link email", "error", err, "userID", user.ID)
+			}
+		})
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusAccepted, map[string]string{
+		"message": "if an account exists for this email, a sign-in link has been sent to it",
+	}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// verifyMagicLinkHandler logs a user in with the token of a sign-in link. The link is consumed even when it is
+// rejected for being used from another client, so that a leaked link cannot be retried.
+func (app *application) verifyMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyMagicLinkPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	link, err := app.store.LoginLinks.Consume(ctx, hashToken(payload.Token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedError(w, r, fmt.Errorf("invalid or expired sign-in link"))
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if app.config.auth.magicLink.bindClient && !sameClient(link, r) {
+		app.unauthorizedError(w, r, fmt.Errorf("sign-in link was requested from another device"))
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, strconv.FormatInt(link.UserID, 10))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Ask for a second factor if needed, or start a new session
+	app.completeLogin(w, r, user)
+}
+
+// sameClient reports whether a request comes from the IP address and user agent a sign-in link was requested with.
+func sameClient(link *store.LoginLink, r *http.Request) bool {
+	ip := subtle.ConstantTimeCompare([]byte(link.IP), []byte(clientIP(r)))
+	userAgent := subtle.ConstantTimeCompare([]byte(link.UserAgent), []byte(r.UserAgent()))
+
+	return ip&userAgent == 1
+}
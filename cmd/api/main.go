@@ -1,14 +1,19 @@
 package main
 
 import (
+	"encoding/base64"
 	"expvar"
+	"net/netip"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/NR3101/social/internal/auth"
 	"github.com/NR3101/social/internal/db"
 	"github.com/NR3101/social/internal/env"
 	"github.com/NR3101/social/internal/mailer"
+	"github.com/NR3101/social/internal/media"
+	"github.com/NR3101/social/internal/oidc"
 	"github.com/NR3101/social/internal/rateLimiter"
 	"github.com/NR3101/social/internal/store"
 	"github.com/NR3101/social/internal/store/cache"
@@ -18,6 +23,12 @@ import (
 
 const version = "1.1.0"
 
+// defaultMFAEncryptionKey encrypts TOTP secrets in development, anyone can read it from the source
+const defaultMFAEncryptionKey = "ZGV2ZWxvcG1lbnRvbmx5bWZhZW5jcnlwdGlvbmtleSE="
+
+// defaultMediaURLSecret signs media URLs in development, anyone can read it from the source
+const defaultMediaURLSecret = "developmentonlymediaurlsigningsecret"
+
 func main() {
 	cfg := config{
 		addr:        env.GetString("ADDR", ":8080"),
@@ -37,6 +48,7 @@ func main() {
 		env: env.GetString("ENV", "development"),
 		mail: mailConfig{
 			exp:       time.Hour * 24 * 3, // 3 days expiration for email tokens
+			resetExp:  time.Hour,          // 1 hour expiration for password reset tokens
 			fromEmail: env.GetString("FROM_EMAIL", "crazyleakey4@typingsquirrel.com"),
 			sendGrid: sendGridConfig{
 				apiKey: env.GetString("SENDGRID_API_KEY", ""),
@@ -46,15 +58,64 @@ func main() {
 			},
 		},
 		auth: authConfig{
-			basic: basicAuthConfig{
-				username: env.GetString("BASIC_AUTH_USERNAME", "admin"),
-				password: env.GetString("BASIC_AUTH_PASSWORD", "admin"),
+			operators: operatorAuthConfig{
+				file:     env.GetString("OPERATORS_FILE", ""),
+				username: env.GetString("BASIC_AUTH_USERNAME", auth.DefaultOperatorUsername),
+				password: env.GetString("BASIC_AUTH_PASSWORD", auth.DefaultOperatorPassword),
 			},
 			token: tokenAuthConfig{
-				secret: env.GetString("TOKEN_SECRET", "averylongandsupersecuresecretkeythatshouldbeatleast256characterslongsothatitcanbeusedforjwt"),
-				exp:    time.Hour * 24 * 3, // 3 days
-				iss:    env.GetString("TOKEN_ISSUER", "SocialApp"),
+				secret:               env.GetString("TOKEN_SECRET", "averylongandsupersecuresecretkeythatshouldbeatleast256characterslongsothatitcanbeusedforjwt"),
+				signingKeyFile:       env.GetString("TOKEN_SIGNING_KEY_FILE", ""),
+				verificationKeyFiles: strings.FieldsFunc(env.GetString("TOKEN_VERIFICATION_KEY_FILES", ""), isComma),
+				exp:                  time.Minute * 15,   // 15 minutes
+				refreshExp:           time.Hour * 24 * 7, // 7 days
+				impersonationExp:     time.Minute * 10,   // 10 minutes, impersonation tokens cannot be refreshed
+				iss:                  env.GetString("TOKEN_ISSUER", "SocialApp"),
+			},
+			oidc: oidcConfig{
+				stateExp: time.Minute * 10, // 10 minutes to log in at the provider
+			},
+			magicLink: magicLinkConfig{
+				exp:        time.Minute * 15, // 15 minutes
+				bindClient: env.GetBool("MAGIC_LINK_BIND_CLIENT", false),
+			},
+			lockout: lockoutConfig{
+				accountThreshold: env.GetInt("LOGIN_LOCKOUT_ACCOUNT_THRESHOLD", 5),
+				ipThreshold:      env.GetInt("LOGIN_LOCKOUT_IP_THRESHOLD", 20),
+				baseLock:         time.Minute,    // 1 minute for the first lock
+				maxLock:          time.Hour,      // 1 hour at most
+				window:           time.Hour * 24, // failures are forgotten after a day
+			},
+		},
+		sweeper: sweeperConfig{
+			interval:    env.GetDuration("UNACTIVATED_USERS_SWEEP_INTERVAL", time.Hour),
+			gracePeriod: env.GetDuration("UNACTIVATED_USERS_GRACE_PERIOD", time.Hour*24*7), // 7 days
+		},
+		publisher: publisherConfig{
+			interval:  env.GetDuration("SCHEDULED_POSTS_PUBLISH_INTERVAL", time.Minute),
+			batchSize: 100,
+		},
+		media: mediaConfig{
+			maxSize:   int64(env.GetInt("MEDIA_MAX_UPLOAD_SIZE", 10<<20)), // 10 MB
+			urlSecret: env.GetString("MEDIA_URL_SECRET", defaultMediaURLSecret),
+			urlExp:    time.Hour,
+			baseURL:   env.GetString("MEDIA_BASE_URL", "http://localhost:8080"),
+			backend:   env.GetString("MEDIA_STORAGE", "local"),
+			localDir:  env.GetString("MEDIA_LOCAL_DIR", "./uploads"),
+			s3: media.S3Config{
+				Endpoint:  env.GetString("MEDIA_S3_ENDPOINT", "http://localhost:9000"),
+				Region:    env.GetString("MEDIA_S3_REGION", "us-east-1"),
+				Bucket:    env.GetString("MEDIA_S3_BUCKET", "media"),
+				AccessKey: env.GetString("MEDIA_S3_ACCESS_KEY", ""),
+				SecretKey: env.GetString("MEDIA_S3_SECRET_KEY", ""),
 			},
+			sweepInterval:    env.GetDuration("UNATTACHED_MEDIA_SWEEP_INTERVAL", time.Hour),
+			unattachedAge:    env.GetDuration("UNATTACHED_MEDIA_GRACE_PERIOD", time.Hour*24), // 1 day
+			sweepSize:        100,
+			processInterval:  env.GetDuration("MEDIA_PROCESS_INTERVAL", time.Second*10),
+			processBatchSize: 10,
+			processLease:     time.Minute * 10, // 10 minutes to process an image
+			processAttempts:  3,
 		},
 		rateLimiter: rateLimiter.Config{
 			RequestPerTimeFrame: env.GetInt("RATE_LIMITER_REQUESTS_PER_TIME_FRAME", 20),
@@ -67,6 +128,30 @@ func main() {
 	logger := zap.Must(zap.NewProduction()).Sugar()
 	defer logger.Sync() // flushes buffer, if any
 
+	// Only the reverse proxies in front of the API may tell the address of clients, anyone could forge the headers
+	for _, cidr := range strings.FieldsFunc(env.GetString("TRUSTED_PROXIES", ""), isComma) {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			logger.Fatalf("Invalid CIDR in TRUSTED_PROXIES: %v", err)
+		}
+		cfg.trustedProxies = append(cfg.trustedProxies, prefix.Masked())
+	}
+
+	// Decode the key used to encrypt TOTP secrets, it must be a base64 encoded 32 byte AES-256 key
+	encodedMFAKey := env.GetString("MFA_ENCRYPTION_KEY", defaultMFAEncryptionKey)
+	if cfg.env == "production" && encodedMFAKey == defaultMFAEncryptionKey {
+		logger.Fatal("Refusing to start in production without MFA_ENCRYPTION_KEY")
+	}
+
+	mfaKey, err := base64.StdEncoding.DecodeString(encodedMFAKey)
+	if err != nil || len(mfaKey) != 32 {
+		logger.Fatal("MFA_ENCRYPTION_KEY must be a base64 encoded 32 byte key")
+	}
+	cfg.auth.mfa = mfaConfig{
+		encryptionKey: mfaKey,
+		pendingExp:    time.Minute * 5, // 5 minutes to enter the second factor
+	}
+
 	// Initialize the database connection
 	db, err := db.New(cfg.db.addr, cfg.db.maxOpenConns, cfg.db.maxIdleConns, cfg.db.maxIdleTime)
 	if err != nil {
@@ -99,8 +184,79 @@ func main() {
 		logger.Info("Error initializing mailer client: %v", err)
 	}
 
-	// Initialize the authenticator
+	// Initialize the authenticator, signing tokens with a private key when one is configured
 	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.iss, cfg.auth.token.iss)
+	if cfg.auth.token.signingKeyFile != "" {
+		signingKey, err := auth.LoadSigningKey(cfg.auth.token.signingKeyFile)
+		if err != nil {
+			logger.Fatalf("Error loading token signing key: %v", err)
+		}
+
+		var verificationKeys []*auth.VerificationKey
+		for _, file := range cfg.auth.token.verificationKeyFiles {
+			key, err := auth.LoadVerificationKey(file)
+			if err != nil {
+				logger.Fatalf("Error loading token verification key: %v", err)
+			}
+			verificationKeys = append(verificationKeys, key)
+		}
+
+		jwtAuthenticator = auth.NewAsymmetricJWTAuthenticator(signingKey, verificationKeys, cfg.auth.token.iss, cfg.auth.token.iss)
+		logger.Infow("Signing tokens with key", "kid", signingKey.ID, "alg", signingKey.Method.Alg())
+	}
+
+	// Load the operator accounts of the health and metrics endpoints, or the single one set in the environment
+	var operators *auth.Operators
+	if cfg.auth.operators.file != "" {
+		operators, err = auth.LoadOperators(cfg.auth.operators.file)
+	} else {
+		operators, err = auth.NewOperator(cfg.auth.operators.username, cfg.auth.operators.password)
+	}
+	if err != nil {
+		logger.Fatalf("Error loading operator accounts: %v", err)
+	}
+
+	if cfg.env == "production" && operators.HasDefaultCredentials() {
+		logger.Fatal("Refusing to start in production with the default operator credentials")
+	}
+
+	// Configure the identity provider users can sign in with, if any
+	if issuer := env.GetString("OIDC_ISSUER", ""); issuer != "" {
+		name := env.GetString("OIDC_PROVIDER_NAME", "oidc")
+		cfg.auth.oidc.providers = append(cfg.auth.oidc.providers, oidc.Config{
+			Name:         name,
+			Issuer:       issuer,
+			ClientID:     env.GetString("OIDC_CLIENT_ID", ""),
+			ClientSecret: env.GetString("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  env.GetString("OIDC_REDIRECT_URL", "http://localhost:8080/v1/authentication/oidc/"+name+"/callback"),
+		})
+	}
+
+	oidcProviders := make(map[string]*oidc.Provider)
+	for _, providerCfg := range cfg.auth.oidc.providers {
+		oidcProviders[providerCfg.Name] = oidc.NewProvider(providerCfg, nil)
+		logger.Infow("Identity provider configured", "provider", providerCfg.Name, "issuer", providerCfg.Issuer)
+	}
+
+	// Anyone knowing the secret can sign URLs to every upload, including those attached to private posts
+	if cfg.env == "production" && cfg.media.urlSecret == defaultMediaURLSecret {
+		logger.Fatal("Refusing to start in production without MEDIA_URL_SECRET")
+	}
+
+	// Initialize the storage of uploaded files
+	var blobs media.BlobStore
+	switch cfg.media.backend {
+	case "local":
+		blobs, err = media.NewLocalStore(cfg.media.localDir)
+		if err != nil {
+			logger.Fatalf("Error initializing media storage: %v", err)
+		}
+	case "s3":
+		blobs = media.NewS3Store(cfg.media.s3, nil)
+	default:
+		logger.Fatalf("MEDIA_STORAGE must be local or s3, got %q", cfg.media.backend)
+	}
+	logger.Infow("Storing media", "backend", cfg.media.backend)
 
 	// Create the application instance with the configuration and storage
 	app := &application{
@@ -111,6 +267,9 @@ func main() {
 		mailer:        mailerClient,
 		authenticator: jwtAuthenticator,
 		rateLimiter:   fixedWindowRateLimiter,
+		oidcProviders: oidcProviders,
+		operators:     operators,
+		blobs:         blobs,
 	}
 
 	// Send metrics using expvar
@@ -127,3 +286,8 @@ func main() {
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 }
+
+// isComma reports whether r separates the values of list environment variables.
+func isComma(r rune) bool {
+	return r == ','
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/NR3101/social/internal/media"
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// mediaTypes are the types of the files that can be uploaded, as sniffed from their content
+var mediaTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "video/mp4"}
+
+// multipartOverhead is the room left in upload requests for the multipart boundaries and part headers
+const multipartOverhead = 64 << 10 // 64 KB
+
+// Uploads get more time than the read timeout of the server, which covers the whole body, so that the largest file
+// allowed still arrives over a slow link
+const (
+	uploadBaseTimeout = time.Second * 10
+	minUploadRate     = 64 << 10 // 64 KB per second
+)
+
+var (
+	errMissingFile      = errors.New("missing file part")
+	errUnsupportedMedia = errors.New("unsupported file type, accepted types are JPEG, PNG, GIF, WebP and MP4")
+	errInvalidMediaURL  = errors.New("invalid or expired download URL")
+	errEmptyMedia       = errors.New("file is empty")
+	errMediaProcessing  = errors.New("media is still being processed")
+)
+
+// uploadMediaHandler stores a file uploaded as the "file" part of a multipart form. The file stays unattached until
+// the uploader lists it in the media of a new post.
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	maxSize := app.config.media.maxSize
+
+	// The response is written once the body was read, so the write deadline moves along with the read deadline
+	deadline := time.Now().Add(uploadTimeout(maxSize + multipartOverhead))
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := rc.SetWriteDeadline(deadline.Add(uploadBaseTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+
+	tmp, size, err := app.readUpload(r, maxSize)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr), size > maxSize:
+			app.payloadTooLargeError(w, r, fmt.Errorf("file must not be larger than %d bytes", maxSize))
+		case errors.Is(err, errMissingFile), errors.Is(err, errEmptyMedia), errors.Is(err, http.ErrNotMultipart):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Trust the content of the file rather than the type the client claims
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	contentType := http.DetectContentType(head[:n])
+	if !slices.Contains(mediaTypes, contentType) {
+		app.unsupportedMediaTypeError(w, r, errUnsupportedMedia)
+		return
+	}
+
+	key, err := media.NewKey()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.blobs.Put(ctx, key, io.NewSectionReader(tmp, 0, size), size, contentType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	m := &store.Media{
+		UserID:      app.getUserFromContext(r).ID,
+		StorageKey:  key,
+		ContentType: contentType,
+		Size:        size,
+		Status:      store.MediaStatusReady,
+	}
+	// Images are only served once their metadata is stripped
+	if media.IsProcessable(contentType) {
+		m.Status = store.MediaStatusPending
+	}
+	if err := app.store.Media.Create(ctx, m); err != nil {
+		if delErr := app.blobs.Delete(context.WithoutCancel(ctx), key); delErr != nil {
+			app.logger.Errorw("failed to delete blob of unrecorded upload", "key", key, "error", delErr)
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.signMedia(m, time.Now())
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, m); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// uploadTimeout returns the time given to read an upload request with a body of the given size.
+func uploadTimeout(size int64) time.Duration {
+	return uploadBaseTimeout + time.Duration(size/minUploadRate)*time.Second
+}
+
+// readUpload copies the file part of an upload to a temporary file, reading at most one byte more than the size
+// limit so that larger files can be told apart. The caller closes and removes the file.
+func (app *application) readUpload(r *http.Request, maxSize int64) (*os.File, int64, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, 0, errMissingFile
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		tmp, err := os.CreateTemp("", "media-upload-*")
+		if err != nil {
+			return nil, 0, err
+		}
+
+		size, err := io.Copy(tmp, io.LimitReader(part, maxSize+1))
+		if err == nil && size > maxSize {
+			err = errors.New("file too large")
+		}
+		if err == nil && size == 0 {
+			err = errEmptyMedia
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, size, err
+		}
+
+		return tmp, size, nil
+	}
+}
+
+// getMediaContentHandler streams the content of a file, or of the variant named by the variant query parameter, to
+// anyone holding a valid download URL, which the API only hands out to users who can see the file.
+func (app *application) getMediaContentHandler(w http.ResponseWriter, r *http.Request) {
+	mediaID, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	variant := query.Get("variant")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || !app.validMediaSignature(mediaID, variant, expires, query.Get("signature"), time.Now()) {
+		app.unauthorizedError(w, r, errInvalidMediaURL)
+		return
+	}
+
+	ctx := r.Context()
+	m, err := app.store.Media.GetByID(ctx, mediaID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	switch m.Status {
+	case store.MediaStatusPending:
+		app.conflictError(w, r, errMediaProcessing)
+		return
+	case store.MediaStatusFailed:
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	key, contentType, size := m.StorageKey, m.ContentType, m.Size
+	if variant != "" {
+		i := slices.IndexFunc(m.Variants, func(v *store.MediaVariant) bool { return v.Name == variant })
+		if i < 0 {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+		key, contentType, size = m.Variants[i].StorageKey, m.Variants[i].ContentType, m.Variants[i].Size
+	}
+
+	content, err := app.blobs.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, media.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	// Caches may keep the file for as long as the URL is valid
+	maxAge := max(expires-time.Now().Unix(), 0)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(maxAge, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		app.logger.Errorw("failed to stream media", "media_id", m.ID, "error", err)
+	}
+}
+
+// mediaURL returns the download URL of a file, or of one of its variants, signed to expire after the configured
+// time.
+func (app *application) mediaURL(mediaID int64, variant string, now time.Time) string {
+	expires := now.Add(app.config.media.urlExp).Unix()
+
+	query := url.Values{}
+	if variant != "" {
+		query.Set("variant", variant)
+	}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", app.mediaSignature(mediaID, variant, expires))
+
+	return fmt.Sprintf("%s/v1/media/%d/content?%s", app.config.media.baseURL, mediaID, query.Encode())
+}
+
+// mediaSignature signs the ID of a file and the name of a variant with the time its download URL expires.
+func (app *application) mediaSignature(mediaID int64, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(app.config.media.urlSecret))
+	fmt.Fprintf(mac, "%d:%s:%d", mediaID, variant, expires)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validMediaSignature reports whether a download URL is unexpired and was signed for the file and variant.
+func (app *application) validMediaSignature(mediaID int64, variant string, expires int64, signature string, now time.Time) bool {
+	if now.Unix() > expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(app.mediaSignature(mediaID, variant, expires)))
+}
+
+// signMedia sets the download URLs of a file and its variants, if it can be served yet.
+func (app *application) signMedia(m *store.Media, now time.Time) {
+	if m.Status != store.MediaStatusReady {
+		return
+	}
+
+	m.URL = app.mediaURL(m.ID, "", now)
+	for _, v := range m.Variants {
+		v.URL = app.mediaURL(m.ID, v.Name, now)
+	}
+}
+
+// loadMedia attaches to posts and to the posts they share the files attached to them, with download URLs.
+func (app *application) loadMedia(ctx context.Context, posts []*store.Post) error {
+	var ids []int64
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+		if post.Original != nil {
+			ids = append(ids, post.Original.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	files, err := app.store.Media.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, post := range posts {
+		app.setMedia(post, files[post.ID], now)
+		if post.Original != nil {
+			app.setMedia(post.Original, files[post.Original.ID], now)
+		}
+	}
+
+	return nil
+}
+
+// setMedia sets the files of a post, signing their download URLs.
+func (app *application) setMedia(post *store.Post, files []*store.Media, now time.Time) {
+	for _, m := range files {
+		app.signMedia(m, now)
+	}
+	post.Media = files
+}
+
+// processMedia strips the metadata of an uploaded image and stores its thumbnails, then marks it ready to be served.
+// Images that cannot be decoded are marked failed, the other errors are returned for the upload to be processed again.
+func (app *application) processMedia(ctx context.Context, m *store.Media) error {
+	content, err := app.blobs.Get(ctx, m.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(content)
+	content.Close()
+	if err != nil {
+		return err
+	}
+
+	processed, err := media.ProcessImage(data, m.ContentType)
+	if errors.Is(err, media.ErrUnsupportedImage) {
+		app.logger.Warnw("uploaded image cannot be processed", "media_id", m.ID, "error", err)
+		return app.store.Media.MarkFailed(ctx, m.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Thumbnails are stored next to the original, which is replaced last
+	m.Variants = nil
+	for _, thumbnail := range processed.Thumbnails {
+		key := m.StorageKey + "-" + thumbnail.Name
+		size := int64(len(thumbnail.Content))
+		if err := app.blobs.Put(ctx, key, bytes.NewReader(thumbnail.Content), size, thumbnail.ContentType); err != nil {
+			return err
+		}
+		m.Variants = append(m.Variants, &store.MediaVariant{
+			Name:        thumbnail.Name,
+			StorageKey:  key,
+			ContentType: thumbnail.ContentType,
+			Width:       thumbnail.Width,
+			Height:      thumbnail.Height,
+			Size:        size,
+		})
+	}
+
+	m.Size = int64(len(processed.Content))
+	if err := app.blobs.Put(ctx, m.StorageKey, bytes.NewReader(processed.Content), m.Size, m.ContentType); err != nil {
+		return err
+	}
+	m.Width, m.Height = &processed.Width, &processed.Height
+	if processed.Blurhash != "" {
+		m.Blurhash = &processed.Blurhash
+	}
+
+	return app.store.Media.SaveProcessed(ctx, m)
+}
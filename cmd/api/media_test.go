@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NR3101/social/internal/media"
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// mediaStoreStub keeps the uploads recorded by Create in memory
+type mediaStoreStub struct {
+	*store.MediaStore
+	uploads []*store.Media
+}
+
+func (s *mediaStoreStub) Create(ctx context.Context, m *store.Media) error {
+	m.ID = int64(len(s.uploads) + 1)
+	s.uploads = append(s.uploads, m)
+	return nil
+}
+
+func (s *mediaStoreStub) GetByID(ctx context.Context, mediaID int64) (*store.Media, error) {
+	if mediaID < 1 || mediaID > int64(len(s.uploads)) {
+		return nil, store.ErrNotFound
+	}
+	return s.uploads[mediaID-1], nil
+}
+
+func (s *mediaStoreStub) SaveProcessed(ctx context.Context, m *store.Media) error {
+	m.Status = store.MediaStatusReady
+	return nil
+}
+
+func (s *mediaStoreStub) MarkFailed(ctx context.Context, mediaID int64) error {
+	s.uploads[mediaID-1].Status = store.MediaStatusFailed
+	return nil
+}
+
+// pngHeader is the start of a PNG file, enough for its type to be sniffed
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// newUploadRequest creates a request uploading content as the file part of a multipart form
+func newUploadRequest(t *testing.T, content []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "upload.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/media", &body)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	return req.WithContext(context.WithValue(req.Context(), "user", &store.User{ID: 1}))
+}
+
+func TestMedia(t *testing.T) {
+	app := newTestApplication(t)
+	blobs, err := media.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobs = blobs
+	app.config.media = mediaConfig{
+		maxSize:   1024,
+		urlSecret: "test-secret",
+		urlExp:    time.Hour,
+		baseURL:   "http://api.test",
+	}
+	uploads := &mediaStoreStub{}
+	app.store.Media = uploads
+
+	// download requests the content of a file at a URL handed out by the API
+	download := func(t *testing.T, rawURL string) *http.Response {
+		t.Helper()
+
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodGet, u.RequestURI(), nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("mediaID", strings.Split(u.Path, "/")[3])
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx))
+
+		return executeRequest(req, http.HandlerFunc(app.getMediaContentHandler)).Result()
+	}
+
+	t.Run("should serve images at signed URLs once processed", func(t *testing.T) {
+		var content bytes.Buffer
+		if err := png.Encode(&content, image.NewGray(image.Rect(0, 0, 40, 20))); err != nil {
+			t.Fatal(err)
+		}
+		rr := executeRequest(newUploadRequest(t, content.Bytes()), http.HandlerFunc(app.uploadMediaHandler))
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		upload := uploads.uploads[len(uploads.uploads)-1]
+		if upload.ContentType != "image/png" || upload.Status != store.MediaStatusPending || upload.URL != "" {
+			t.Errorf("expected a pending PNG without URL, got %q %q %q", upload.ContentType, upload.Status, upload.URL)
+		}
+		checkResponseCode(t, http.StatusConflict, download(t, app.mediaURL(upload.ID, "", time.Now())).StatusCode)
+
+		if err := app.processMedia(context.Background(), upload); err != nil {
+			t.Fatalf("Failed to process media: %v", err)
+		}
+		app.signMedia(upload, time.Now())
+		if upload.Status != store.MediaStatusReady || len(upload.Variants) != 1 || *upload.Blurhash == "" {
+			t.Fatalf("expected a ready image with a thumbnail and a blurhash, got %+v", upload)
+		}
+
+		resp := download(t, upload.URL)
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		if got := resp.Header.Get("Content-Type"); got != "image/png" {
+			t.Errorf("expected content type image/png, got %q", got)
+		}
+
+		resp = download(t, upload.Variants[0].URL)
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		if got := resp.Header.Get("Content-Type"); got != "image/jpeg" {
+			t.Errorf("expected a JPEG thumbnail, got %q", got)
+		}
+	})
+
+	t.Run("should never serve images that cannot be processed", func(t *testing.T) {
+		content := append(pngHeader, make([]byte, 100)...)
+		rr := executeRequest(newUploadRequest(t, content), http.HandlerFunc(app.uploadMediaHandler))
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		upload := uploads.uploads[len(uploads.uploads)-1]
+		if err := app.processMedia(context.Background(), upload); err != nil {
+			t.Fatalf("Failed to process media: %v", err)
+		}
+		if upload.Status != store.MediaStatusFailed {
+			t.Errorf("expected corrupted image to fail, got %q", upload.Status)
+		}
+		checkResponseCode(t, http.StatusNotFound, download(t, app.mediaURL(upload.ID, "", time.Now())).StatusCode)
+	})
+
+	t.Run("should refuse files of other types", func(t *testing.T) {
+		rr := executeRequest(newUploadRequest(t, []byte("<html><script>alert(1)</script></html>")), http.HandlerFunc(app.uploadMediaHandler))
+		checkResponseCode(t, http.StatusUnsupportedMediaType, rr.Code)
+	})
+
+	t.Run("should give slow uploads more time than the read timeout of the server", func(t *testing.T) {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.uploadMediaHandler(w, r.WithContext(context.WithValue(r.Context(), "user", &store.User{ID: 1})))
+		}))
+		srv.Config.ReadTimeout = time.Millisecond * 50
+		srv.Start()
+		defer srv.Close()
+
+		upload := newUploadRequest(t, append(pngHeader, make([]byte, 100)...))
+		content, err := io.ReadAll(upload.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// send the body in two halves, well past the read timeout apart
+		body, bodyWriter := io.Pipe()
+		go func() {
+			bodyWriter.Write(content[:len(content)/2])
+			time.Sleep(time.Millisecond * 200)
+			bodyWriter.Write(content[len(content)/2:])
+			bodyWriter.Close()
+		}()
+
+		resp, err := srv.Client().Post(srv.URL, upload.Header.Get("Content-Type"), body)
+		if err != nil {
+			t.Fatalf("Failed to upload: %v", err)
+		}
+		resp.Body.Close()
+		checkResponseCode(t, http.StatusCreated, resp.StatusCode)
+	})
+
+	t.Run("should refuse files over the size limit", func(t *testing.T) {
+		content := append(pngHeader, make([]byte, 1024)...)
+		rr := executeRequest(newUploadRequest(t, content), http.HandlerFunc(app.uploadMediaHandler))
+		checkResponseCode(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+
+	t.Run("should refuse tampered and expired URLs", func(t *testing.T) {
+		signed, err := url.Parse(app.mediaURL(1, "", time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A signature is only valid for the file it was made for
+		tampered := *signed
+		tampered.Path = "/v1/media/2/content"
+		checkResponseCode(t, http.StatusUnauthorized, download(t, tampered.String()).StatusCode)
+
+		// and for the variant it was made for
+		query := signed.Query()
+		query.Set("variant", "small")
+		tampered.Path = signed.Path
+		tampered.RawQuery = query.Encode()
+		checkResponseCode(t, http.StatusUnauthorized, download(t, tampered.String()).StatusCode)
+
+		// Moving the expiry forward invalidates the signature
+		query = signed.Query()
+		query.Set("expires", "9999999999")
+		tampered.RawQuery = query.Encode()
+		checkResponseCode(t, http.StatusUnauthorized, download(t, tampered.String()).StatusCode)
+
+		expired := app.mediaURL(1, "", time.Now().Add(-2*app.config.media.urlExp))
+		checkResponseCode(t, http.StatusUnauthorized, download(t, expired).StatusCode)
+	})
+}
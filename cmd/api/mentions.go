@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// getMentionsHandler lists a page of the posts and comments mentioning the authenticated user, newest first.
+func (app *application) getMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,     // Default limit for pagination
+		Offset: 0,      // Default offset for pagination
+		Sort:   "desc", // Default sort order
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	mentions, err := app.store.Mentions.ListByUserID(r.Context(), app.getUserFromContext(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, mentions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getNotificationsHandler lists a page of the notifications of the authenticated user, newest first. With
+// ?unread=true, only the unread ones are listed.
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,     // Default limit for pagination
+		Offset: 0,      // Default offset for pagination
+		Sort:   "desc", // Default sort order
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var unreadOnly bool
+	if unread := r.URL.Query().Get("unread"); unread != "" {
+		if unreadOnly, err = strconv.ParseBool(unread); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+	}
+
+	notifications, err := app.store.Notifications.ListByUserID(r.Context(), app.getUserFromContext(r).ID, unreadOnly, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, notifications); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// readNotificationHandler marks a notification of the authenticated user read. Reading it again does nothing.
+func (app *application) readNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Notifications.MarkRead(r.Context(), app.getUserFromContext(r).ID, notificationID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// readAllNotificationsHandler marks every notification of the authenticated user read.
+func (app *application) readAllNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := app.store.Notifications.MarkAllRead(r.Context(), app.getUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, map[string]int64{"read": count}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// loadPostMentions attaches to posts and to the posts they share the users mentioned in their content.
+func (app *application) loadPostMentions(ctx context.Context, posts []*store.Post) error {
+	var ids []int64
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+		if post.Original != nil {
+			ids = append(ids, post.Original.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	mentions, err := app.store.Mentions.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Mentions = mentions[post.ID]
+		if post.Original != nil {
+			post.Original.Mentions = mentions[post.Original.ID]
+		}
+	}
+
+	return nil
+}
+
+// loadCommentMentions attaches to comments and to their loaded replies the users mentioned in their content.
+func (app *application) loadCommentMentions(ctx context.Context, comments []*store.Comment) error {
+	var ids []int64
+	var collect func([]*store.Comment)
+	collect = func(comments []*store.Comment) {
+		for _, comment := range comments {
+			ids = append(ids, comment.ID)
+			collect(comment.Replies)
+		}
+	}
+	collect(comments)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	mentions, err := app.store.Mentions.GetByCommentIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var set func([]*store.Comment)
+	set = func(comments []*store.Comment) {
+		for _, comment := range comments {
+			comment.Mentions = mentions[comment.ID]
+			set(comment.Replies)
+		}
+	}
+	set(comments)
+
+	return nil
+}
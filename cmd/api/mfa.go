@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NR3101/social/internal/auth"
+	"github.com/NR3101/social/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mfaPendingTokenType is the type claim of the tokens given to logins waiting for a second factor
+const mfaPendingTokenType = "mfa_pending"
+
+// recoveryCodesCount is the number of recovery codes generated when two-factor authentication is enabled
+const recoveryCodesCount = 10
+
+// MFACodePayload defines the structure for payloads carrying a TOTP code
+type MFACodePayload struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// MFASecondFactorPayload defines the structure for payloads carrying either a TOTP code or a recovery code
+type MFASecondFactorPayload struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,max=32"`
+}
+
+// MFAVerifyPayload defines the structure for the payload completing a login with a second factor
+type MFAVerifyPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	MFASecondFactorPayload
+}
+
+// MFAEnrollResponse is returned when a user enrolls in two-factor authentication
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`      // Base32 encoded TOTP secret, for manual entry
+	OTPAuthURI string `json:"otpauth_uri"` // otpauth URI of the secret, to be shown as a QR code
+}
+
+// MFAChallengeResponse is returned by a login that needs a second factor to complete
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`  // Token to post along with the second factor
+	ExpiresIn   int64  `json:"expires_in"` // Lifetime of the token in seconds
+}
+
+// completeLogin finishes a login once the user has proven who they are. With two-factor authentication enabled it
+// responds with a short-lived token to exchange for a second factor, otherwise it starts a session.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *store.User) {
+	ctx := r.Context()
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if mfa != nil && mfa.Enabled {
+		token, err := app.generateMFAToken(user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		challenge := &MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    token,
+			ExpiresIn:   int64(app.config.auth.mfa.pendingExp.Seconds()),
+		}
+
+		if err := app.writeJSONResponse(w, http.StatusOK, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// The login is complete, forget the failed attempts of the account
+	if err := app.resetLoginFailures(ctx, user.Email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Start a new session and issue its tokens
+	tokens, err := app.issueTokens(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.auditAs(r, user, auditLogin, store.AuditTargetUser, user.ID, nil, nil)
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// verifyMFAHandler completes a login that is waiting for a second factor
+func (app *application) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFAVerifyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// validate the pending login token
+	jwtToken, err := app.authenticator.ValidateToken(payload.MFAToken)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	if typ, _ := claims["typ"].(string); typ != mfaPendingTokenType {
+		app.unauthorizedError(w, r, fmt.Errorf("invalid token type"))
+		return
+	}
+
+	userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetByID(ctx, strconv.FormatInt(userID, 10))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !mfa.Enabled {
+		app.unauthorizedError(w, r, fmt.Errorf("two-factor authentication is not enabled"))
+		return
+	}
+
+	// Second factors are guessed like passwords, so they count towards the same lockout
+	retryAfter, err := app.checkLoginLockout(ctx, r, user.Email)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.accountLockedError(w, r, retryAfter)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(ctx, mfa, payload.MFASecondFactorPayload)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !ok {
+		if err := app.recordLoginFailure(ctx, r, user.Email, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.unauthorizedError(w, r, fmt.Errorf("invalid second factor"))
+		return
+	}
+
+	// The login is complete, forget the failed attempts of the account
+	if err := app.resetLoginFailures(ctx, user.Email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Start a new session and issue its tokens
+	tokens, err := app.issueTokens(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.auditAs(r, user, auditLogin, store.AuditTargetUser, user.ID, nil, nil)
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// enrollMFAHandler generates a new TOTP secret for the authenticated user. Two-factor authentication is only enabled
+// once a first code generated from the secret is verified.
+func (app *application) enrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getUserFromContext(r)
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Encrypt the secret before storing it
+	encrypted, err := auth.Encrypt(app.config.auth.mfa.encryptionKey, []byte(secret))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.Enroll(r.Context(), user.ID, encrypted); err != nil {
+		if errors.Is(err, store.ErrMFAAlreadyEnabled) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	response := &MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(app.config.auth.token.iss, user.Email, secret),
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// enableMFAHandler enables two-factor authentication for the authenticated user with a first code, and returns the
+// recovery codes of the user. They are only ever shown here.
+func (app *application) enableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getUserFromContext(r)
+
+	ctx := r.Context()
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.badRequestError(w, r, fmt.Errorf("two-factor authentication is not enrolled"))
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if mfa.Enabled {
+		app.badRequestError(w, r, store.ErrMFAAlreadyEnabled)
+		return
+	}
+
+	secret, err := auth.Decrypt(app.config.auth.mfa.encryptionKey, mfa.Secret)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(string(secret), payload.Code, time.Now())
+	if !ok {
+		app.badRequestError(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.Enable(ctx, user.ID, step, hashes); err != nil {
+		if errors.Is(err, store.ErrMFAAlreadyEnabled) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, map[string][]string{"recovery_codes": codes}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// disableMFAHandler disables two-factor authentication for the authenticated user, who must provide a second factor.
+func (app *application) disableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFASecondFactorPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getUserFromContext(r)
+
+	ctx := r.Context()
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.badRequestError(w, r, fmt.Errorf("two-factor authentication is not enrolled"))
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// A pending enrollment can be dropped without a code
+	if mfa.Enabled {
+		ok, err := app.verifySecondFactor(ctx, mfa, payload)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !ok {
+			app.badRequestError(w, r, fmt.Errorf("invalid second factor"))
+			return
+		}
+	}
+
+	if err := app.store.MFA.Disable(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// verifySecondFactor checks a TOTP code or a recovery code for a user, consuming it so it cannot be used again.
+func (app *application) verifySecondFactor(ctx context.Context, mfa *store.MFA, payload MFASecondFactorPayload) (bool, error) {
+	if payload.RecoveryCode != "" {
+		err := app.store.MFA.UseRecoveryCode(ctx, mfa.UserID, hashToken(normalizeRecoveryCode(payload.RecoveryCode)))
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	secret, err := auth.Decrypt(app.config.auth.mfa.encryptionKey, mfa.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTP(string(secret), payload.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// refuse a code that was already used
+	if err := app.store.MFA.UseStep(ctx, mfa.UserID, step); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// generateMFAToken generates the short-lived token of a login waiting for a second factor
+func (app *application) generateMFAToken(userID int64) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,                                                // Subject (user ID)
+		"typ": mfaPendingTokenType,                                   // Only accepted by the second factor endpoint
+		"exp": time.Now().Add(app.config.auth.mfa.pendingExp).Unix(), // Expiration time
+		"iat": time.Now().Unix(),                                     // Issued at time
+		"nbf": time.Now().Unix(),                                     // Not before time
+		"iss": app.config.auth.token.iss,                             // Issuer
+		"aud": app.config.auth.token.iss,                             // Audience
+	}
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+// generateRecoveryCodes generates random recovery codes, returning them along with their hashes
+func generateRecoveryCodes(n int) ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		// format as xxxx-xxxx-xxxx-xxxx for readability
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		hashes[i] = hashToken(code)
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips the formatting of a recovery code typed by a user
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
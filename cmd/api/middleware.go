@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/NR3101/social/internal/store"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-// checkPostOwnership is an authorization middleware that checks if the user is the owner of a post.
-func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+// checkPostOwnership is an authorization middleware that checks if the user is the owner of a post, or holds the
+// permission to act on the posts of other users.
+func (app *application) checkPostOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := app.getUserFromContext(r)
 		post := app.getPostFromContext(r)
@@ -24,8 +28,8 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 			return
 		}
 
-		// check if the user has the required role to access the resource
-		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		// check if the user has the required permission to access the resource
+		allowed, err := app.hasPermission(r.Context(), user, permission)
 		if err != nil {
 			app.internalServerError(w, r, err)
 			return
@@ -40,14 +44,24 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 	}
 }
 
-// checkRolePrecedence checks if the user has the required role to access the resource.
-func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
-	role, err := app.store.Roles.GetByName(ctx, roleName)
-	if err != nil {
-		return false, err
-	}
+// requirePermission is an authorization middleware that only lets users holding the permission through.
+func (app *application) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.hasPermission(r.Context(), app.getUserFromContext(r), permission)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
 
-	return user.Role.Level >= role.Level, nil
+			if !allowed {
+				app.forbiddenError(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 // AuthTokenMiddleware is a middleware function that implements token-based authentication.
@@ -62,11 +76,17 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 
 		// parse the Authorization header
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "ApiKey") {
 			app.unauthorizedError(w, r, fmt.Errorf("invalid Authorization header format"))
 			return
 		}
 
+		// API keys are looked up by their hash rather than validated as tokens
+		if parts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, next, parts[1])
+			return
+		}
+
 		// validate the token
 		token := parts[1]
 		jwtToken, err := app.authenticator.ValidateToken(token)
@@ -75,29 +95,135 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// get the user ID from the token claims
+		// get the user ID from the token claims, only access tokens are accepted here
 		claims, _ := jwtToken.Claims.(jwt.MapClaims)
+		if _, ok := claims["typ"]; ok {
+			app.unauthorizedError(w, r, fmt.Errorf("invalid token type"))
+			return
+		}
+
 		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
 		if err != nil {
 			app.unauthorizedError(w, r, err)
 			return
 		}
 
-		// retrieve the user from the cache or database
+		// make sure the session the token was issued for has not been revoked
 		ctx := r.Context()
+		sessionID, _ := claims["sid"].(string)
+		if _, err := uuid.Parse(sessionID); err != nil {
+			app.unauthorizedError(w, r, fmt.Errorf("invalid session"))
+			return
+		}
+
+		session, err := app.store.Sessions.GetByID(ctx, sessionID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.unauthorizedError(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if session.RevokedAt != nil {
+			app.unauthorizedError(w, r, fmt.Errorf("session has been revoked"))
+			return
+		}
+
+		// retrieve the user from the cache or database
 		user, err := app.getUser(ctx, strconv.FormatInt(userID, 10))
 		if err != nil {
 			app.unauthorizedError(w, r, err)
 			return
 		}
 
-		// set the user in the request context
+		// set the user and their session in the request context
 		ctx = context.WithValue(ctx, "user", user)
+		ctx = context.WithValue(ctx, "session", session)
+
+		// tokens minted to impersonate the user name the administrator acting as them in the act claim
+		if act, ok := claims["act"]; ok {
+			actor, err := app.authenticateActor(ctx, act, session)
+			if err != nil {
+				app.unauthorizedError(w, r, err)
+				return
+			}
+
+			// set the administrator in the request context, and keep track of everything they do as the user
+			ctx = context.WithValue(ctx, "actor", actor)
+			r = r.WithContext(ctx)
+			app.audit(r, auditImpersonatedRequest, store.AuditTargetUser, user.ID, nil, map[string]any{
+				"method": r.Method,
+				"path":   r.URL.Path,
+			})
+		}
+
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 
 }
 
+// authenticateAPIKey authenticates a request with an API key and sets the user and the key in the request context.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plainKey string) {
+	if !strings.HasPrefix(plainKey, apiKeyPrefix) {
+		app.unauthorizedError(w, r, fmt.Errorf("invalid API key"))
+		return
+	}
+
+	ctx := r.Context()
+	key, err := app.store.APIKeys.Authenticate(ctx, hashToken(plainKey))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedError(w, r, fmt.Errorf("invalid or expired API key"))
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// retrieve the user the key acts as from the cache or database
+	user, err := app.getUser(ctx, strconv.FormatInt(key.UserID, 10))
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+
+	// set the user and the key in the request context
+	ctx = context.WithValue(ctx, "user", user)
+	ctx = context.WithValue(ctx, "apiKey", key)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requireScope is an authorization middleware that only lets requests authenticated with an API key through if the
+// key was granted the scope. Requests authenticated with an access token are not restricted.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := app.getAPIKeyFromContext(r)
+			if key != nil && !slices.Contains(key.Scopes, scope) {
+				app.forbiddenError(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// denyAPIKey is an authorization middleware that rejects requests authenticated with an API key, for routes that
+// manage the account itself and require the user to be logged in.
+func (app *application) denyAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.getAPIKeyFromContext(r) != nil {
+			app.forbiddenError(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // getUser retrieves a user from the cache or database.
 func (app *application) getUser(ctx context.Context, userID string) (*store.User, error) {
 	if !app.config.redisCfg.enabled {
@@ -123,38 +249,30 @@ func (app *application) getUser(ctx context.Context, userID string) (*store.User
 	return user, nil
 }
 
-// BasicAuthMiddleware is a middleware function that implements basic authentication.
-func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
+// OperatorAuthMiddleware is a middleware function that authenticates operators with basic authentication and
+// checks that they may access the endpoint from the address of the request.
+func (app *application) OperatorAuthMiddleware(endpoint string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// read the Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				app.unauthorizedBasicAuthError(w, r, fmt.Errorf("missing Authorization header"))
-				return
-			}
-
-			// parse the Authorization header
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Basic" {
-				app.unauthorizedBasicAuthError(w, r, fmt.Errorf("invalid Authorization header format"))
+			// read and decode the basic authentication credentials
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				app.unauthorizedBasicAuthError(w, r, fmt.Errorf("missing or invalid Authorization header"))
 				return
 			}
 
-			// decode the base64 encoded credentials
-			credentials, err := base64.StdEncoding.DecodeString(parts[1])
-			if err != nil {
-				app.unauthorizedBasicAuthError(w, r, err)
+			// check the credentials
+			operator, ok := app.operators.Authenticate(username, password)
+			if !ok {
+				app.unauthorizedBasicAuthError(w, r, fmt.Errorf("invalid credentials"))
 				return
 			}
 
-			// check the credentials
-			username := app.config.auth.basic.username
-			password := app.config.auth.basic.password
-
-			creds := strings.SplitN(string(credentials), ":", 2)
-			if len(creds) != 2 || creds[0] != username || creds[1] != password {
-				app.unauthorizedBasicAuthError(w, r, fmt.Errorf("invalid credentials"))
+			// check the operator may access the endpoint from where the request comes from, which is the peer of the
+			// connection unless it is a trusted proxy
+			ip, err := netip.ParseAddr(clientIP(r))
+			if err != nil || !operator.Allows(endpoint, ip) {
+				app.forbiddenError(w, r)
 				return
 			}
 
@@ -163,6 +281,53 @@ func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	}
 }
 
+// realIP replaces the remote address of requests coming through a trusted proxy with the address of the client the
+// proxy forwarded them for. X-Forwarded-For is read from the right, skipping the trusted proxies, since clients can
+// put any address at its start. The headers of requests from other peers are ignored, so that clients cannot choose
+// the address the operator allow-lists, the login lockout and the rate limiter see.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := netip.ParseAddr(clientIP(r))
+		if err != nil || !app.isTrustedProxy(peer) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			forwarded = append(forwarded, strings.Split(header, ",")...)
+		}
+
+		client := peer
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			ip, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+			if err != nil {
+				break
+			}
+			client = ip.Unmap()
+			if !app.isTrustedProxy(client) {
+				break
+			}
+		}
+		if len(forwarded) == 0 {
+			if ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+				client = ip.Unmap()
+			}
+		}
+
+		r.RemoteAddr = client.String()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isTrustedProxy reports whether an address belongs to one of the trusted reverse proxies.
+func (app *application) isTrustedProxy(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return slices.ContainsFunc(app.config.trustedProxies, func(prefix netip.Prefix) bool {
+		return prefix.Contains(ip)
+	})
+}
+
 // RateLimiterMiddleware is a middleware function that implements rate limiting.
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
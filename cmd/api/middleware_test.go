@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NR3101/social/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOperatorAuthMiddleware(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("operator-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "operators.json")
+	operators := `[{"username": "ops", "password_hash": "` + string(hash) + `", "endpoints": ["health"],
+		"allowed_cidrs": ["10.0.0.0/24"]}]`
+	if err := os.WriteFile(file, []byte(operators), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication(t)
+	if app.operators, err = auth.LoadOperators(file); err != nil {
+		t.Fatal(err)
+	}
+	app.config.trustedProxies = []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := app.realIP(app.OperatorAuthMiddleware(auth.OperatorEndpointHealth)(ok))
+
+	// request sends a health check from a peer address with the given headers
+	request := func(t *testing.T, peer string, headers map[string]string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/health", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.RemoteAddr = peer
+		req.SetBasicAuth("ops", "operator-password")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		return executeRequest(req, handler).Code
+	}
+
+	t.Run("should allow operators from their allowed networks", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, "10.0.0.7:51000", nil))
+	})
+
+	t.Run("should ignore the forwarded headers of clients", func(t *testing.T) {
+		for _, header := range []string{"True-Client-IP", "X-Real-IP", "X-Forwarded-For"} {
+			checkResponseCode(t, http.StatusForbidden, request(t, "203.0.113.9:51000", map[string]string{header: "10.0.0.1"}))
+		}
+	})
+
+	t.Run("should take the client address from trusted proxies", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, "192.168.1.2:443", map[string]string{"X-Forwarded-For": "10.0.0.1"}))
+	})
+
+	t.Run("should ignore the addresses clients prepend through trusted proxies", func(t *testing.T) {
+		headers := map[string]string{"X-Forwarded-For": "10.0.0.1, 203.0.113.9"}
+		checkResponseCode(t, http.StatusForbidden, request(t, "192.168.1.2:443", headers))
+	})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NR3101/social/internal/oidc"
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Usernames derived from identities are cut to leave room for a suffix within the 20 characters usernames may have
+const (
+	oidcUsernameMaxBase  = 13
+	oidcUsernameAttempts = 3
+)
+
+// oidcStateCookie is the cookie binding a login to the browser that started it, holding the hash of its state
+const oidcStateCookie = "oidc_state"
+
+// errEmailNotVerified is returned when a provider does not vouch for the email of a new identity
+var errEmailNotVerified = errors.New("the identity provider did not verify the email of the account")
+
+// oidcLoginHandler starts a login at an identity provider by redirecting to its login page.
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundError(w, r, fmt.Errorf("unknown identity provider"))
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	loginState := &store.OIDCLoginState{
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}
+
+	if err := app.store.Identities.CreateLoginState(ctx, loginState, hashToken(state), app.config.auth.oidc.stateExp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Only the browser that started the login can complete it, so a callback URL cannot be handed to someone else
+	http.SetCookie(w, app.newOIDCStateCookie(r, hashToken(state), int(app.config.auth.oidc.stateExp.Seconds())))
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler completes a login at an identity provider. The user is found by their identity, or else linked
+// or created by the email the provider verified, and then logged in like with a password.
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundError(w, r, fmt.Errorf("unknown identity provider"))
+		return
+	}
+
+	qs := r.URL.Query()
+	if errCode := qs.Get("error"); errCode != "" {
+		app.unauthorizedError(w, r, fmt.Errorf("identity provider returned an error: %s", errCode))
+		return
+	}
+
+	code, state := qs.Get("code"), qs.Get("state")
+	if code == "" || state == "" {
+		app.badRequestError(w, r, fmt.Errorf("missing code or state"))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hashToken(state))) != 1 {
+		app.unauthorizedError(w, r, fmt.Errorf("login was started in another browser"))
+		return
+	}
+	http.SetCookie(w, app.newOIDCStateCookie(r, "", -1))
+
+	ctx := r.Context()
+	loginState, err := app.store.Identities.ConsumeLoginState(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedError(w, r, fmt.Errorf("invalid or expired login state"))
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if loginState.Provider != provider.Name() {
+		app.unauthorizedError(w, r, fmt.Errorf("login was started with another identity provider"))
+		return
+	}
+
+	claims, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+
+	user, err := app.resolveOIDCUser(ctx, provider.Name(), claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrIdentityLinked):
+			app.unauthorizedError(w, r, err)
+		case errors.Is(err, errEmailNotVerified), errors.Is(err, store.ErrDuplicateEmail):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Ask for a second factor if needed, or start a new session
+	app.completeLogin(w, r, user)
+}
+
+// newOIDCStateCookie returns the cookie binding a login at the provider of the request to the browser, scoped to the
+// routes of the provider. A negative max age removes the cookie.
+func (app *application) newOIDCStateCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/v1/authentication/oidc/" + chi.URLParam(r, "provider"),
+		MaxAge:   maxAge,
+		Secure:   app.config.env == "production",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// resolveOIDCUser returns the user an identity belongs to. An unknown identity is linked to the user with the same
+// email, or to a new user, but only if the provider verified the email.
+func (app *application) resolveOIDCUser(ctx context.Context, provider string, claims *oidc.Claims) (*store.User, error) {
+	identity, err := app.store.Identities.GetByProviderSubject(ctx, provider, claims.Subject)
+	if err == nil {
+		return app.store.Users.GetByID(ctx, strconv.FormatInt(identity.UserID, 10))
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+
+	identity = &store.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	// Link the identity to the account registered with the same email
+	user, err := app.store.Users.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		identity.UserID = user.ID
+		if err := app.store.Identities.Link(ctx, identity); err != nil {
+			return nil, err
+		}
+
+		app.logger.Infow("Identity linked", "userID", user.ID, "provider", provider)
+		return app.store.Users.GetByID(ctx, strconv.FormatInt(user.ID, 10))
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	// Create a new account, with a random password the user can replace through a password reset
+	password, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	base := oidcUsernameBase(claims)
+	for attempt := 0; ; attempt++ {
+		user = &store.User{
+			Username: base,
+			Email:    claims.Email,
+			Role: &store.Role{
+				Name: "user", // Default role for new users
+			},
+		}
+		if err := user.Password.Set(password); err != nil {
+			return nil, err
+		}
+
+		// Usernames are unique, add a random suffix if the derived one is taken
+		if attempt > 0 {
+			suffix := make([]byte, 3)
+			if _, err := rand.Read(suffix); err != nil {
+				return nil, err
+			}
+			user.Username = base + "-" + hex.EncodeToString(suffix)
+		}
+
+		err = app.store.Users.CreateWithIdentity(ctx, user, identity)
+		if !errors.Is(err, store.ErrDuplicateUsername) || attempt == oidcUsernameAttempts {
+			break
+		}
+	}
+	if err != nil {
+		// An account awaiting activation holds the email
+		if errors.Is(err, store.ErrDuplicateEmail) {
+			return nil, fmt.Errorf("%w, activate the account first", err)
+		}
+		return nil, err
+	}
+
+	app.logger.Infow("User registered with identity provider", "userID", user.ID, "provider", provider)
+	return app.store.Users.GetByID(ctx, strconv.FormatInt(user.ID, 10))
+}
+
+// oidcUsernameBase derives a username from the preferred username or the email of an identity.
+func oidcUsernameBase(claims *oidc.Claims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	// Keep the characters that are safe in URLs and mentions
+	var b strings.Builder
+	for _, r := range candidate {
+		if r < 128 && (r == '_' || r == '-' || r == '.' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			b.WriteRune(r)
+		}
+		if b.Len() == oidcUsernameMaxBase {
+			break
+		}
+	}
+
+	if b.Len() < 3 {
+		return "user"
+	}
+
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/NR3101/social/internal/oidc"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	provider, err := oidc.NewMockServer()
+	if err != nil {
+		t.Fatalf("Failed to start mock provider: %v", err)
+	}
+	defer provider.Close()
+
+	app := newTestApplication(t)
+	app.oidcProviders = map[string]*oidc.Provider{
+		"mock": oidc.NewProvider(provider.Config("http://localhost/v1/authentication/oidc/mock/callback"), provider.Client()),
+	}
+	mux := app.mount()
+
+	// login starts a login and follows the mock provider back, returning the callback request
+	login := func(t *testing.T) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/authentication/oidc/mock/login", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusFound, rr.Code)
+
+		client := provider.Client()
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		resp, err := client.Get(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Failed to sign in at the provider: %v", err)
+		}
+		resp.Body.Close()
+
+		callback, err := http.NewRequest(http.MethodGet, resp.Header.Get("Location"), nil)
+		if err != nil {
+			t.Fatalf("Failed to create callback request: %v", err)
+		}
+
+		// the callback comes back to the browser that started the login
+		for _, cookie := range rr.Result().Cookies() {
+			callback.AddCookie(cookie)
+		}
+
+		return callback
+	}
+
+	t.Run("should issue tokens for a verified identity", func(t *testing.T) {
+		rr := executeRequest(login(t), mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("should not complete a login twice", func(t *testing.T) {
+		callback := login(t)
+
+		rr := executeRequest(callback, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		rr = executeRequest(callback, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should not complete a login started in another browser", func(t *testing.T) {
+		callback := login(t)
+		callback.Header.Del("Cookie")
+
+		rr := executeRequest(callback, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+		other := login(t)
+		for _, cookie := range other.Cookies() {
+			callback.AddCookie(cookie)
+		}
+
+		rr = executeRequest(callback, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should reject an unverified email", func(t *testing.T) {
+		provider.Claims.EmailVerified = false
+		defer func() { provider.Claims.EmailVerified = true }()
+
+		rr := executeRequest(login(t), mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should reject an unknown provider", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/authentication/oidc/unknown/login", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+}
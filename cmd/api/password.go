@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/NR3101/social/internal/mailer"
+	"github.com/NR3101/social/internal/store"
+)
+
+// ForgotPasswordPayload defines the structure for the forgot password payload
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=100"`
+}
+
+// ResetPasswordPayload defines the structure for the reset password payload
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=100"`
+}
+
+// forgotPasswordHandler emails a password reset link to the user with the given email. It responds the same way
+// whether or not an account exists for the email, so it cannot be used to find out who is registered.
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if user != nil {
+		plainToken, err := generateToken()
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := app.store.Users.CreatePasswordReset(ctx, user.ID, hashToken(plainToken), app.config.mail.resetExp); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// email variables
+		isProdEnv := app.config.env == "production"
+		vars := struct {
+			Username  string
+			ResetURL  string
+			ExpiresIn string
+		}{
+			Username:  user.Username,
+			ResetURL:  fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken),
+			ExpiresIn: app.config.mail.resetExp.String(),
+		}
+
+		// Send the email in the background so the response time does not depend on whether the account exists
+		app.background(func() {
+			if _, err := app.mailer.Send(mailer.PasswordResetTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+				app.logger.Errorw("failed to send password reset email", "error", err, "userID", user.ID)
+			}
+		})
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusAccepted, map[string]string{
+		"message": "if an account exists for this email, a password reset link has been sent to it",
+	}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// resetPasswordHandler sets a new password using a reset token, signs the user out of every session and deletes
+// the API keys of the user.
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Validate the payload
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Hash the new password
+	user := &store.User{}
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.ResetPassword(r.Context(), hashToken(payload.Token), user); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Infow("Password reset successfully", "userID", user.ID)
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
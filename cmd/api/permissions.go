@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/NR3101/social/internal/store"
+)
+
+// Permissions granted to roles, as named in the permissions table
+const (
+	permPostUpdateAny    = "post.update.any"    // Update posts of other users
+	permPostDeleteAny    = "post.delete.any"    // Delete posts of other users
+	permCommentModerate  = "comment.moderate"   // Update comments of other users
+	permCommentDeleteAny = "comment.delete.any" // Delete comments of other users
+	permUserUnlock       = "user.unlock"        // Unlock accounts locked after failed logins
+	permInvitationRead   = "invitation.read"    // List accounts awaiting activation
+	permRoleManage       = "role.manage"        // Manage roles and the roles of users
+	permAuditRead        = "audit.read"         // Query and export the audit trail
+	permUserImpersonate  = "user.impersonate"   // Act as another user to reproduce their issues
+)
+
+// hasPermission checks if any of the roles of the user grants the permission.
+func (app *application) hasPermission(ctx context.Context, user *store.User, permission string) (bool, error) {
+	permissions, err := app.getPermissions(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(permissions, permission), nil
+}
+
+// getPermissions retrieves the permissions of a user from the cache or database.
+func (app *application) getPermissions(ctx context.Context, userID int64) ([]string, error) {
+	if !app.config.redisCfg.enabled {
+		return app.store.Roles.GetUserPermissions(ctx, userID)
+	}
+
+	permissions, err := app.cacheStorage.Permissions.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if permissions == nil {
+		permissions, err = app.store.Roles.GetUserPermissions(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := app.cacheStorage.Permissions.Set(ctx, userID, permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	return permissions, nil
+}
@@ -2,23 +2,39 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/NR3101/social/internal/store"
 	"github.com/go-chi/chi/v5"
 )
 
+// Defaults for the comment threads embedded in a post response
+const (
+	postThreadsLimit      = 10 // number of top-level comment threads embedded in a post
+	postThreadsDepth      = 3  // number of reply levels loaded below each thread
+	postThreadsReplyLimit = 5  // number of replies loaded per comment
+)
+
 // CreatePostPayload represents the payload for creating a new post
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,min=1,max=255"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title      string     `json:"title" validate:"required,min=1,max=255"`
+	Content    string     `json:"content" validate:"required,max=1000"`
+	Tags       []string   `json:"tags"`
+	Visibility string     `json:"visibility" validate:"omitempty,oneof=public followers private unlisted"`
+	Status     string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt  *time.Time `json:"publish_at"`                                  // Publication time of scheduled posts
+	MediaIDs   []int64    `json:"media_ids" validate:"max=4,unique,dive,gt=0"` // Uploaded files to attach, in order
 }
 
 // UpdatePostPayload represents the payload for updating an existing post
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,min=1,max=255"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title      *string    `json:"title" validate:"omitempty,min=1,max=255"`
+	Content    *string    `json:"content" validate:"omitempty,max=1000"`
+	Visibility *string    `json:"visibility" validate:"omitempty,oneof=public followers private unlisted"`
+	Status     *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt  *time.Time `json:"publish_at"` // Publication time of scheduled posts
 }
 
 // createPostHandler handles the creation of a new post.
@@ -38,17 +54,35 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 
 	user := app.getUserFromContext(r)
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  user.ID,
+		Title:      payload.Title,
+		Content:    payload.Content,
+		Tags:       payload.Tags,
+		UserID:     user.ID,
+		Visibility: payload.Visibility,
+	}
+	for _, id := range payload.MediaIDs {
+		post.Media = append(post.Media, &store.Media{ID: id})
+	}
+
+	status := payload.Status
+	if status == "" {
+		status = store.PostStatusPublished
+	}
+	if err := applyPublication(post, status, payload.PublishAt); err != nil {
+		app.badRequestError(w, r, err)
+		return
 	}
 
 	ctx := r.Context()
 	if err := app.store.Posts.Create(ctx, post); err != nil {
+		if errors.Is(err, store.ErrMediaUnavailable) {
+			app.badRequestError(w, r, err)
+			return
+		}
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.setMedia(post, post.Media, time.Now())
 
 	if err := app.writeJSONResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -60,13 +94,40 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := app.getPostFromContext(r)
 
-	// Retrieve comments for the post
-	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID)
+	// Retrieve the top comment threads for the post, the rest can be loaded with the cursor
+	comments, cursor, err := app.store.Comments.GetThreads(r.Context(), post.ID, store.CommentThreadQuery{
+		Limit:        postThreadsLimit,
+		MaxDepth:     postThreadsDepth,
+		RepliesLimit: postThreadsReplyLimit,
+	})
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 	post.Comments = comments
+	post.CommentsCursor = cursor
+
+	// Attach the reposted or quoted post
+	if err := app.store.Posts.LoadOriginals(r.Context(), app.getUserFromContext(r).ID, []*store.Post{post}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Attach the uploaded files of the post and of the shared post
+	if err := app.loadMedia(r.Context(), []*store.Post{post}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// Attach the users mentioned in the post, in the shared post and in the comments
+	if err := app.loadPostMentions(r.Context(), []*store.Post{post}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.loadCommentMentions(r.Context(), post.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
 	if err := app.writeJSONResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -88,6 +149,8 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.audit(r, auditPostDelete, store.AuditTargetPost, postID, postAuditFields(app.getPostFromContext(r)), nil)
+
 	app.writeJSONResponse(w, http.StatusOK, map[string]string{
 		"postID":  postID,
 		"message": "Post deleted successfully",
@@ -98,6 +161,10 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve the post from the context
 	post := app.getPostFromContext(r)
+	if post.Kind == store.PostKindRepost {
+		app.badRequestError(w, r, errors.New("reposts cannot be edited"))
+		return
+	}
 
 	// Marshal the request body into the UpdatePostPayload
 	var payload UpdatePostPayload
@@ -112,6 +179,8 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	before := postAuditFields(post)
+
 	// Update the post fields if they are provided in the payload
 	if payload.Title != nil {
 		post.Title = *payload.Title
@@ -119,6 +188,19 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	if payload.Content != nil {
 		post.Content = *payload.Content
 	}
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
+	if payload.Status != nil || payload.PublishAt != nil {
+		status := post.Status
+		if payload.Status != nil {
+			status = *payload.Status
+		}
+		if err := applyPublication(post, status, payload.PublishAt); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+	}
 
 	// Update the post in the store
 	ctx := r.Context()
@@ -131,13 +213,16 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.audit(r, auditPostUpdate, store.AuditTargetPost, post.ID, before, postAuditFields(post))
+
 	if err := app.writeJSONResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
-// postsContextMiddleware is a middleware that retrieves a post by its ID from the URL
+// postsContextMiddleware is a middleware that retrieves a post by its ID from the URL. Posts the authenticated user
+// cannot see are reported as not found, so that their existence is not revealed.
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		postID := chi.URLParam(r, "postID")
@@ -153,15 +238,88 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		visible, err := app.canViewPost(ctx, app.getUserFromContext(r), post)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !visible {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
 		// Store the post in the context for use in subsequent handlers
 		ctx = context.WithValue(ctx, "post", post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// canViewPost reports whether a user may see a post according to its status and visibility.
+func (app *application) canViewPost(ctx context.Context, user *store.User, post *store.Post) (bool, error) {
+	switch {
+	case post.UserID == user.ID:
+		return true, nil
+	case post.Status != store.PostStatusPublished:
+		return false, nil
+	case post.Visibility == store.PostVisibilityPublic || post.Visibility == store.PostVisibilityUnlisted:
+		return true, nil
+	case post.Visibility == store.PostVisibilityFollowers:
+		return app.store.Followers.IsFollowing(ctx, post.UserID, user.ID)
+	default:
+		return false, nil
+	}
+}
+
+// applyPublication sets the publication status of a post, checking that scheduled posts get a publication time in
+// the future and that published posts stay published.
+func applyPublication(post *store.Post, status string, publishAt *time.Time) error {
+	if post.Status == store.PostStatusPublished && status != store.PostStatusPublished {
+		return errors.New("published posts cannot be turned back into drafts")
+	}
+
+	if status != store.PostStatusScheduled {
+		if publishAt != nil {
+			return errors.New("publish_at can only be set on scheduled posts")
+		}
+		post.Status = status
+		post.PublishAt = nil
+		return nil
+	}
+
+	// Scheduled posts keep their publication time unless a new one is given
+	if publishAt == nil {
+		if post.PublishAt == nil {
+			return errors.New("scheduled posts need a publish_at time")
+		}
+		post.Status = status
+		return nil
+	}
+	if !publishAt.After(time.Now()) {
+		return errors.New("publish_at must be in the future")
+	}
+
+	at := publishAt.UTC().Format(time.RFC3339)
+	post.Status = status
+	post.PublishAt = &at
+	return nil
+}
+
 // getPostFromContext retrieves the post from the request context.
 func (app *application) getPostFromContext(r *http.Request) *store.Post {
 	post, _ := r.Context().Value("post").(*store.Post)
 
 	return post
 }
+
+// postAuditFields returns the fields of a post recorded in the audit trail.
+func postAuditFields(post *store.Post) map[string]any {
+	return map[string]any{
+		"title":      post.Title,
+		"content":    post.Content,
+		"user_id":    post.UserID,
+		"tags":       post.Tags,
+		"visibility": post.Visibility,
+		"status":     post.Status,
+		"publish_at": post.PublishAt,
+	}
+}
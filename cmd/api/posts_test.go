@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// postStoreStub serves a single post from GetByID
+type postStoreStub struct {
+	*store.PostStore
+	post *store.Post
+}
+
+func (s *postStoreStub) GetByID(ctx context.Context, postID string) (*store.Post, error) {
+	return s.post, nil
+}
+
+// followerStoreStub answers IsFollowing with a fixed relationship
+type followerStoreStub struct {
+	*store.FollowerStore
+	following bool
+}
+
+func (s *followerStoreStub) IsFollowing(ctx context.Context, followedID int64, userID int64) (bool, error) {
+	return s.following, nil
+}
+
+func TestPostVisibility(t *testing.T) {
+	const authorID, viewerID = 1, 2
+
+	tests := []struct {
+		visibility string
+		status     string
+		author     bool // whether the author views the post
+		following  bool // whether the viewer follows the author
+		expected   int
+	}{
+		{store.PostVisibilityPublic, store.PostStatusPublished, false, false, http.StatusOK},
+		{store.PostVisibilityPublic, store.PostStatusPublished, false, true, http.StatusOK},
+		{store.PostVisibilityUnlisted, store.PostStatusPublished, false, false, http.StatusOK},
+		{store.PostVisibilityFollowers, store.PostStatusPublished, true, false, http.StatusOK},
+		{store.PostVisibilityFollowers, store.PostStatusPublished, false, true, http.StatusOK},
+		{store.PostVisibilityFollowers, store.PostStatusPublished, false, false, http.StatusNotFound},
+		{store.PostVisibilityPrivate, store.PostStatusPublished, true, false, http.StatusOK},
+		{store.PostVisibilityPrivate, store.PostStatusPublished, false, true, http.StatusNotFound},
+		{store.PostVisibilityPrivate, store.PostStatusPublished, false, false, http.StatusNotFound},
+		{store.PostVisibilityPublic, store.PostStatusDraft, true, false, http.StatusOK},
+		{store.PostVisibilityPublic, store.PostStatusDraft, false, true, http.StatusNotFound},
+		{store.PostVisibilityPublic, store.PostStatusScheduled, true, false, http.StatusOK},
+		{store.PostVisibilityPublic, store.PostStatusScheduled, false, false, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		name := tt.status + " " + tt.visibility + " post seen by a stranger"
+		switch {
+		case tt.author:
+			name = tt.status + " " + tt.visibility + " post seen by its author"
+		case tt.following:
+			name = tt.status + " " + tt.visibility + " post seen by a follower"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.store.Posts = &postStoreStub{post: &store.Post{ID: 1, UserID: authorID, Visibility: tt.visibility, Status: tt.status}}
+			app.store.Followers = &followerStoreStub{following: tt.following}
+
+			viewer := &store.User{ID: viewerID}
+			if tt.author {
+				viewer.ID = authorID
+			}
+
+			req, err := http.NewRequest(http.MethodGet, "/v1/posts/1", nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			routeCtx := chi.NewRouteContext()
+			routeCtx.URLParams.Add("postID", "1")
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+			ctx = context.WithValue(ctx, "user", viewer)
+
+			handler := app.postsContextMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			rr := executeRequest(req.WithContext(ctx), handler)
+
+			checkResponseCode(t, tt.expected, rr.Code)
+		})
+	}
+}
+
+func TestApplyPublication(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	t.Run("should schedule a post in the future", func(t *testing.T) {
+		post := &store.Post{}
+		if err := applyPublication(post, store.PostStatusScheduled, &future); err != nil {
+			t.Fatal(err)
+		}
+		if post.Status != store.PostStatusScheduled || post.PublishAt == nil {
+			t.Errorf("expected a scheduled post, got %q at %v", post.Status, post.PublishAt)
+		}
+	})
+
+	t.Run("should refuse schedules without a time in the future", func(t *testing.T) {
+		if err := applyPublication(&store.Post{}, store.PostStatusScheduled, nil); err == nil {
+			t.Error("expected a schedule without time to be refused")
+		}
+		if err := applyPublication(&store.Post{}, store.PostStatusScheduled, &past); err == nil {
+			t.Error("expected a schedule in the past to be refused")
+		}
+		if err := applyPublication(&store.Post{}, store.PostStatusDraft, &future); err == nil {
+			t.Error("expected a draft with a publication time to be refused")
+		}
+	})
+
+	t.Run("should publish a scheduled post right away", func(t *testing.T) {
+		at := future.Format(time.RFC3339)
+		post := &store.Post{Status: store.PostStatusScheduled, PublishAt: &at}
+		if err := applyPublication(post, store.PostStatusPublished, nil); err != nil {
+			t.Fatal(err)
+		}
+		if post.Status != store.PostStatusPublished || post.PublishAt != nil {
+			t.Errorf("expected a published post, got %q at %v", post.Status, post.PublishAt)
+		}
+	})
+
+	t.Run("should not unpublish a post", func(t *testing.T) {
+		post := &store.Post{Status: store.PostStatusPublished}
+		if err := applyPublication(post, store.PostStatusDraft, nil); err == nil {
+			t.Error("expected a published post to stay published")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// addReactionHandler adds a reaction of the authenticated user to a post. Reacting twice the same way does nothing.
+func (app *application) addReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reactionType, ok := app.reactionTypeParam(w, r)
+	if !ok {
+		return
+	}
+
+	reaction := &store.Reaction{
+		PostID: app.getPostFromContext(r).ID,
+		UserID: app.getUserFromContext(r).ID,
+		Type:   reactionType,
+	}
+
+	if err := app.store.Reactions.Add(r.Context(), reaction); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// removeReactionHandler removes a reaction of the authenticated user from a post.
+func (app *application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reactionType, ok := app.reactionTypeParam(w, r)
+	if !ok {
+		return
+	}
+
+	post := app.getPostFromContext(r)
+	user := app.getUserFromContext(r)
+
+	if err := app.store.Reactions.Remove(r.Context(), post.ID, user.ID, reactionType); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getReactionsHandler lists who reacted to a post, newest first, optionally of a single type given as ?type=.
+func (app *application) getReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,     // Default limit for pagination
+		Offset: 0,      // Default offset for pagination
+		Sort:   "desc", // Default sort order
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	reactionType := r.URL.Query().Get("type")
+	if reactionType != "" && !slices.Contains(store.ReactionTypes, reactionType) {
+		app.badRequestError(w, r, fmt.Errorf("unknown reaction type %q", reactionType))
+		return
+	}
+
+	post := app.getPostFromContext(r)
+	reactions, err := app.store.Reactions.ListByPostID(r.Context(), post.ID, reactionType, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, reactions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// reactionTypeParam returns the reaction type of the URL, writing the error response if it is unknown.
+func (app *application) reactionTypeParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	reactionType := chi.URLParam(r, "type")
+	if !slices.Contains(store.ReactionTypes, reactionType) {
+		app.badRequestError(w, r, fmt.Errorf("unknown reaction type %q", reactionType))
+		return "", false
+	}
+
+	return reactionType, true
+}
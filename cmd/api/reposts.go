@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NR3101/social/internal/store"
+)
+
+// errNotShareable is returned when sharing a post that is not public or not published yet, which would show it to
+// users it is hidden from.
+var errNotShareable = errors.New("only published public posts can be shared")
+
+// QuotePostPayload represents the payload for quoting a post
+type QuotePostPayload struct {
+	Content    string   `json:"content" validate:"required,max=1000"`
+	Tags       []string `json:"tags"`
+	Visibility string   `json:"visibility" validate:"omitempty,oneof=public followers private unlisted"`
+}
+
+// repostHandler shares a post with the followers of the authenticated user. Reposting a repost shares its original.
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	original, ok := app.sharedPost(w, r)
+	if !ok {
+		return
+	}
+	if original.Visibility != store.PostVisibilityPublic || original.Status != store.PostStatusPublished {
+		app.badRequestError(w, r, errNotShareable)
+		return
+	}
+
+	user := app.getUserFromContext(r)
+	repost := &store.Post{
+		UserID:     user.ID,
+		Kind:       store.PostKindRepost,
+		OriginalID: &original.ID,
+	}
+
+	if err := app.store.Posts.Create(r.Context(), repost); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateRepost):
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	repost.Original = original
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, repost); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// unrepostHandler removes the repost of a post by the authenticated user.
+func (app *application) unrepostHandler(w http.ResponseWriter, r *http.Request) {
+	original, ok := app.sharedPost(w, r)
+	if !ok {
+		return
+	}
+
+	user := app.getUserFromContext(r)
+	if err := app.store.Posts.DeleteRepost(r.Context(), original.ID, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// quotePostHandler shares a post with commentary of the authenticated user. Quoting a repost quotes its original.
+func (app *application) quotePostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload QuotePostPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	original, ok := app.sharedPost(w, r)
+	if !ok {
+		return
+	}
+	if original.Visibility != store.PostVisibilityPublic || original.Status != store.PostStatusPublished {
+		app.badRequestError(w, r, errNotShareable)
+		return
+	}
+
+	quote := &store.Post{
+		Content:    payload.Content,
+		Tags:       payload.Tags,
+		UserID:     app.getUserFromContext(r).ID,
+		Kind:       store.PostKindQuote,
+		OriginalID: &original.ID,
+		Visibility: payload.Visibility,
+	}
+
+	if err := app.store.Posts.Create(r.Context(), quote); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	quote.Original = original
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, quote); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// sharedPost returns the post a share of the post in the context points at: the original for reposts, the post
+// itself otherwise. It writes the error response if the original cannot be loaded.
+func (app *application) sharedPost(w http.ResponseWriter, r *http.Request) (*store.Post, bool) {
+	post := app.getPostFromContext(r)
+	if post.Kind != store.PostKindRepost {
+		return post, true
+	}
+
+	user := app.getUserFromContext(r)
+	if err := app.store.Posts.LoadOriginals(r.Context(), user.ID, []*store.Post{post}); err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	if post.Original == nil {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return nil, false
+	}
+
+	return post.Original, true
+}
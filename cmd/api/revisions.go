@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/NR3101/social/internal/textdiff"
+	"github.com/go-chi/chi/v5"
+)
+
+// revisionDiffContext is the number of unchanged lines shown around each change of a revision diff
+const revisionDiffContext = 3
+
+// PostRevisionDiff represents a version of a post compared to another one
+type PostRevisionDiff struct {
+	From *store.PostRevision `json:"from"` // Version compared against, none when diffing the first version
+	To   *store.PostRevision `json:"to"`
+	Diff string              `json:"diff"` // Unified diff of the title and content from one version to the other
+}
+
+// getPostRevisionsHandler lists the versions of a post, newest first, starting with the current one. Only the author
+// and the users who may update any post can read them.
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := app.getPostFromContext(r)
+
+	revisions, err := app.store.Posts.GetRevisions(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	revisions = append([]*store.PostRevision{currentRevision(post)}, revisions...)
+
+	if err := app.writeJSONResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getPostRevisionHandler returns a version of a post with the diff of what it changed. The version is compared to
+// the previous one, or to the one given as ?from=. Only the author and the users who may update any post can read it.
+func (app *application) getPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := app.getPostFromContext(r)
+
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	from := version - 1
+	if param := r.URL.Query().Get("from"); param != "" {
+		from, err = strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid from version: %w", err))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	revision, err := app.getPostRevision(ctx, post, version)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// The version before the first one is empty
+	response := PostRevisionDiff{To: revision}
+	var fromText string
+	if from >= 0 {
+		response.From, err = app.getPostRevision(ctx, post, from)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.notFoundError(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+		fromText = revisionText(response.From)
+	}
+
+	response.Diff = textdiff.Unified(fmt.Sprintf("v%d", from), fmt.Sprintf("v%d", version), fromText,
+		revisionText(revision), revisionDiffContext)
+
+	if err := app.writeJSONResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// restorePostRevisionHandler makes a previous version of a post its current version again. The replaced version is
+// kept as a revision like with any update.
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := app.getPostFromContext(r)
+
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if version == post.Version {
+		app.badRequestError(w, r, errors.New("version is already the current one"))
+		return
+	}
+
+	ctx := r.Context()
+	revision, err := app.store.Posts.GetRevision(ctx, post.ID, version)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	before := postAuditFields(post)
+	post.Title = revision.Title
+	post.Content = revision.Content
+
+	if err := app.store.Posts.Update(ctx, post); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	after := postAuditFields(post)
+	after["restored_version"] = version
+	app.audit(r, auditPostRestore, store.AuditTargetPost, post.ID, before, after)
+
+	if err := app.writeJSONResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getPostRevision returns a version of a post, the current one coming from the post itself.
+func (app *application) getPostRevision(ctx context.Context, post *store.Post, version int64) (*store.PostRevision, error) {
+	if version == post.Version {
+		return currentRevision(post), nil
+	}
+
+	return app.store.Posts.GetRevision(ctx, post.ID, version)
+}
+
+// currentRevision returns the current version of a post as a revision.
+func currentRevision(post *store.Post) *store.PostRevision {
+	return &store.PostRevision{
+		PostID:    post.ID,
+		Version:   post.Version,
+		Title:     post.Title,
+		Content:   post.Content,
+		CreatedAt: post.UpdatedAt,
+	}
+}
+
+// revisionText returns a version of a post as it is diffed, its title on the first line followed by its content.
+func revisionText(revision *store.PostRevision) string {
+	return revision.Title + "\n\n" + revision.Content
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// revisionStoreStub serves a single previous version of a post
+type revisionStoreStub struct {
+	*store.PostStore
+	revision *store.PostRevision
+}
+
+func (s *revisionStoreStub) GetRevision(ctx context.Context, postID, version int64) (*store.PostRevision, error) {
+	if version != s.revision.Version {
+		return nil, store.ErrNotFound
+	}
+	return s.revision, nil
+}
+
+// roleStoreStub grants the same permissions to every user
+type roleStoreStub struct {
+	*store.RoleStore
+	permissions []string
+}
+
+func (s *roleStoreStub) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	return s.permissions, nil
+}
+
+func TestPostRevisions(t *testing.T) {
+	const authorID, viewerID = 1, 2
+
+	app := newTestApplication(t)
+	app.store.Posts = &revisionStoreStub{revision: &store.PostRevision{PostID: 1, Version: 0, Title: "Draft", Content: "secret"}}
+	roles := &roleStoreStub{}
+	app.store.Roles = roles
+
+	// getRevision requests the diff of the current version of a post as a user
+	getRevision := func(t *testing.T, userID int64) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/1/revisions/1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("version", "1")
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
+		ctx = context.WithValue(ctx, "user", &store.User{ID: userID})
+		ctx = context.WithValue(ctx, "post", &store.Post{ID: 1, UserID: authorID, Version: 1, Title: "Final", Content: "public"})
+
+		handler := app.checkPostOwnership(permPostUpdateAny, app.getPostRevisionHandler)
+		return executeRequest(req.WithContext(ctx), handler).Result()
+	}
+
+	t.Run("should hide the versions of a post from other users", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, getRevision(t, viewerID).StatusCode)
+	})
+
+	t.Run("should show the changes of the title and content to the author", func(t *testing.T) {
+		resp := getRevision(t, authorID)
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+
+		var body struct {
+			Data PostRevisionDiff `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		for _, change := range []string{"-Draft", "+Final", "-secret", "+public"} {
+			if !strings.Contains(body.Data.Diff, change+"\n") {
+				t.Errorf("expected %q in the diff, got %q", change, body.Data.Diff)
+			}
+		}
+	})
+
+	t.Run("should show the versions of a post to moderators", func(t *testing.T) {
+		roles.permissions = []string{permPostUpdateAny}
+		checkResponseCode(t, http.StatusOK, getRevision(t, viewerID).StatusCode)
+	})
+}
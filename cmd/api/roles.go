@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NR3101/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateRolePayload represents the payload for creating a role
+type CreateRolePayload struct {
+	Name        string   `json:"name" validate:"required,min=2,max=50"`
+	Description string   `json:"description" validate:"max=255"`
+	Level       int      `json:"level" validate:"gte=0,lte=100"`
+	Permissions []string `json:"permissions" validate:"dive,required,max=100"`
+}
+
+// UpdateRolePayload represents the payload for updating an existing role
+type UpdateRolePayload struct {
+	Name        *string   `json:"name" validate:"omitempty,min=2,max=50"`
+	Description *string   `json:"description" validate:"omitempty,max=255"`
+	Level       *int      `json:"level" validate:"omitempty,gte=0,lte=100"`
+	Permissions *[]string `json:"permissions" validate:"omitempty,dive,required,max=100"`
+}
+
+// getRolesHandler lists all roles with the permissions they grant.
+func (app *application) getRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.store.Roles.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getRoleHandler returns a role with the permissions it grants.
+func (app *application) getRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role := app.getRoleFromContext(r)
+
+	if err := app.writeJSONResponse(w, http.StatusOK, role); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// createRoleHandler creates a role granting the given permissions.
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	role := &store.Role{
+		Name:        payload.Name,
+		Description: payload.Description,
+		Level:       payload.Level,
+		Permissions: payload.Permissions,
+	}
+
+	if err := app.store.Roles.Create(r.Context(), role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateRole):
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrUnknownPermission):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditRoleCreate, store.AuditTargetRole, role.ID, nil, role)
+
+	if err := app.writeJSONResponse(w, http.StatusCreated, role); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// updateRoleHandler updates a role. The cached users holding it are invalidated, as their permissions may change.
+func (app *application) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role := app.getRoleFromContext(r)
+
+	var payload UpdateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	before := *role
+
+	// Update the role fields if they are provided in the payload
+	if payload.Name != nil {
+		role.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		role.Description = *payload.Description
+	}
+	if payload.Level != nil {
+		role.Level = *payload.Level
+	}
+	if payload.Permissions != nil {
+		role.Permissions = *payload.Permissions
+	}
+
+	ctx := r.Context()
+	if err := app.store.Roles.Update(ctx, role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrDuplicateRole):
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrUnknownPermission):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditRoleUpdate, store.AuditTargetRole, role.ID, before, role)
+
+	if err := app.invalidateRoleHolders(ctx, role.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusOK, role); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteRoleHandler deletes a role, unless it is the primary role of some users.
+func (app *application) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	role := app.getRoleFromContext(r)
+
+	// Look up the users holding the role before it is taken away from them
+	ctx := r.Context()
+	userIDs, err := app.store.Roles.GetUserIDs(ctx, role.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Roles.Delete(ctx, role.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrRoleInUse):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditRoleDelete, store.AuditTargetRole, role.ID, role, nil)
+
+	if err := app.invalidateUsers(ctx, userIDs...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// assignUserRoleHandler grants a role to a user.
+func (app *application) assignUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	role := app.getRoleFromContext(r)
+
+	ctx := r.Context()
+	if err := app.store.Roles.AssignToUser(ctx, userID, role.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditUserRoleAssign, store.AuditTargetUser, userID, nil, map[string]any{"role": role.Name})
+
+	if err := app.invalidateUsers(ctx, userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// removeUserRoleHandler takes a role away from a user, unless it is their primary role.
+func (app *application) removeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	role := app.getRoleFromContext(r)
+
+	ctx := r.Context()
+	if err := app.store.Roles.RemoveFromUser(ctx, userID, role.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrRoleInUse):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditUserRoleRemove, store.AuditTargetUser, userID, map[string]any{"role": role.Name}, nil)
+
+	if err := app.invalidateUsers(ctx, userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// rolesContextMiddleware loads the role of the roleID URL parameter into the request context.
+func (app *application) rolesContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		role, err := app.store.Roles.GetByID(ctx, roleID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.notFoundError(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// Store the role in the context for use in subsequent handlers
+		ctx = context.WithValue(ctx, "role", role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// getRoleFromContext retrieves the role from the request context.
+func (app *application) getRoleFromContext(r *http.Request) *store.Role {
+	role, _ := r.Context().Value("role").(*store.Role)
+
+	return role
+}
+
+// invalidateRoleHolders removes the users holding a role from the cache.
+func (app *application) invalidateRoleHolders(ctx context.Context, roleID int64) error {
+	if !app.config.redisCfg.enabled {
+		return nil
+	}
+
+	userIDs, err := app.store.Roles.GetUserIDs(ctx, roleID)
+	if err != nil {
+		return err
+	}
+
+	return app.invalidateUsers(ctx, userIDs...)
+}
+
+// invalidateUsers removes users and their permissions from the cache, so that changes to their roles apply to their
+// next request.
+func (app *application) invalidateUsers(ctx context.Context, userIDs ...int64) error {
+	if !app.config.redisCfg.enabled {
+		return nil
+	}
+
+	for _, userID := range userIDs {
+		if err := app.cacheStorage.Users.Delete(ctx, userID); err != nil {
+			return err
+		}
+		if err := app.cacheStorage.Permissions.Delete(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
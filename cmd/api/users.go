@@ -87,7 +87,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	// Activate the user account using the token
 	ctx := r.Context()
-	if err := app.store.Users.Activate(ctx, token); err != nil {
+	userID, err := app.store.Users.Activate(ctx, token)
+	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundError(w, r, err)
 			return
@@ -96,6 +97,9 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	app.auditAs(r, nil, auditUserActivate, store.AuditTargetUser, userID,
+		map[string]any{"is_active": false}, map[string]any{"is_active": true})
+
 	// Respond with a 204 No Content status
 	if err := app.writeJSONResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
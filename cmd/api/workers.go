@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/NR3101/social/internal/store"
+)
+
+// startWorkers starts the periodic background jobs of the server. They stop when the context is canceled, and the
+// server waits for them to return before shutting down.
+func (app *application) startWorkers(ctx context.Context) {
+	app.background(func() {
+		app.every(ctx, app.config.sweeper.interval, app.sweepUnactivatedUsers)
+	})
+	app.background(func() {
+		app.every(ctx, app.config.publisher.interval, app.publishScheduledPosts)
+	})
+	app.background(func() {
+		app.every(ctx, app.config.media.sweepInterval, app.sweepUnattachedMedia)
+	})
+	app.background(func() {
+		app.every(ctx, app.config.media.processInterval, app.processPendingMedia)
+	})
+}
+
+// every runs a job at the given interval until the context is canceled.
+func (app *application) every(ctx context.Context, interval time.Duration, job func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job(ctx)
+		}
+	}
+}
+
+// publishScheduledPosts publishes the scheduled posts that are due, in batches until none is left. Replicas running
+// it at the same time share the due posts.
+func (app *application) publishScheduledPosts(ctx context.Context) {
+	var total int64
+	for {
+		published, err := app.store.Posts.PublishScheduled(ctx, app.config.publisher.batchSize)
+		if err != nil {
+			app.logger.Errorw("failed to publish scheduled posts", "error", err)
+			break
+		}
+
+		total += published
+		if published < int64(app.config.publisher.batchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		app.logger.Infow("Published scheduled posts", "count", total)
+	}
+}
+
+// sweepUnactivatedUsers deletes the accounts that were never activated within the grace period.
+func (app *application) sweepUnactivatedUsers(ctx context.Context) {
+	deleted, err := app.store.Users.DeleteUnactivated(ctx, app.config.sweeper.gracePeriod)
+	if err != nil {
+		app.logger.Errorw("failed to delete unactivated users", "error", err)
+		return
+	}
+
+	if deleted > 0 {
+		app.logger.Infow("Deleted unactivated users", "count", deleted)
+	}
+}
+
+// processPendingMedia processes the uploaded images waiting to be served, in batches until none is left. Replicas
+// running it at the same time share the pending images. Images failing too many times are marked failed.
+func (app *application) processPendingMedia(ctx context.Context) {
+	cfg := app.config.media
+	for {
+		pending, err := app.store.Media.ClaimPending(ctx, cfg.processBatchSize, cfg.processLease)
+		if err != nil {
+			app.logger.Errorw("failed to claim pending media", "error", err)
+			return
+		}
+
+		for _, m := range pending {
+			err := app.processMedia(ctx, m)
+			if err == nil {
+				continue
+			}
+			app.logger.Errorw("failed to process media", "media_id", m.ID, "attempt", m.Attempts, "error", err)
+			if m.Attempts >= cfg.processAttempts {
+				if err := app.store.Media.MarkFailed(ctx, m.ID); err != nil {
+					app.logger.Errorw("failed to mark media failed", "media_id", m.ID, "error", err)
+				}
+			}
+		}
+
+		if len(pending) < cfg.processBatchSize {
+			return
+		}
+	}
+}
+
+// sweepUnattachedMedia deletes the uploads that were not attached to any post within the grace period, or whose post
+// was deleted, along with their content.
+func (app *application) sweepUnattachedMedia(ctx context.Context) {
+	unattached, err := app.store.Media.GetUnattached(ctx, app.config.media.unattachedAge, app.config.media.sweepSize)
+	if err != nil {
+		app.logger.Errorw("failed to get unattached media", "error", err)
+		return
+	}
+
+	var deleted int
+	for _, m := range unattached {
+		// Forget the upload first so that it cannot be attached to a post once its content is gone
+		if err := app.store.Media.Delete(ctx, m.ID); err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				app.logger.Errorw("failed to delete unattached media", "media_id", m.ID, "error", err)
+			}
+			continue
+		}
+		keys := []string{m.StorageKey}
+		for _, v := range m.Variants {
+			keys = append(keys, v.StorageKey)
+		}
+		for _, key := range keys {
+			if err := app.blobs.Delete(ctx, key); err != nil {
+				app.logger.Errorw("failed to delete content of unattached media", "key", key, "error", err)
+			}
+		}
+		deleted++
+	}
+
+	if deleted > 0 {
+		app.logger.Infow("Deleted unattached media", "count", deleted)
+	}
+}
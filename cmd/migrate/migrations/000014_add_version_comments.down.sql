@@ -0,0 +1,2 @@
+ALTER TABLE comments
+    DROP COLUMN version;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE comments
+    ADD COLUMN version INT DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_comments_post_id_roots;
+DROP INDEX IF EXISTS idx_comments_parent_id;
+
+ALTER TABLE comments
+    DROP COLUMN depth,
+    DROP COLUMN path,
+    DROP COLUMN parent_id;
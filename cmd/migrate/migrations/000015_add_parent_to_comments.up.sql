@@ -0,0 +1,14 @@
+-- path is the materialized path of comment IDs from the thread root down to the comment itself
+ALTER TABLE comments
+    ADD COLUMN parent_id BIGINT REFERENCES comments (id) ON DELETE CASCADE,
+    ADD COLUMN path      BIGINT[],
+    ADD COLUMN depth     INT NOT NULL DEFAULT 0;
+
+UPDATE comments
+SET path = ARRAY [id];
+
+ALTER TABLE comments
+    ALTER COLUMN path SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_roots ON comments (post_id, id) WHERE parent_id IS NULL;
@@ -0,0 +1,20 @@
+-- A session groups every refresh token issued from a single login, so that the whole token family can be revoked
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id         UUID PRIMARY KEY                     DEFAULT gen_random_uuid(),
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    token      bytea PRIMARY KEY,
+    session_id UUID                        NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    expiry     TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    used_at    TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
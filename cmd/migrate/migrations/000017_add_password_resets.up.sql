@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS password_resets
+(
+    token      bytea PRIMARY KEY,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expiry     TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
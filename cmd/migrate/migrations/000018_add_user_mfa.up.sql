@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS user_mfa
+(
+    user_id        BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret         bytea                       NOT NULL, -- TOTP secret encrypted with AES-GCM
+    enabled        BOOLEAN                     NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT                      NOT NULL DEFAULT 0, -- last accepted time step, to prevent code replay
+    created_at     TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    enabled_at     TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes
+(
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code       bytea                       NOT NULL,
+    used_at    TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, code)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         VARCHAR(100)                NOT NULL,
+    prefix       VARCHAR(16)                 NOT NULL, -- first characters of the key, to tell keys apart
+    key          bytea                       NOT NULL UNIQUE,
+    scopes       TEXT[]                      NOT NULL DEFAULT '{}',
+    expiry       TIMESTAMP(0) WITH TIME ZONE,
+    last_used_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
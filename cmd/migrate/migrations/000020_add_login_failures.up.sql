@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    kind            VARCHAR(16)                 NOT NULL, -- 'account' for an email, 'ip' for a client address
+    key             VARCHAR(255)                NOT NULL,
+    failures        INT                         NOT NULL DEFAULT 0,
+    locked_until    TIMESTAMP(0) WITH TIME ZONE,
+    last_failure_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (kind, key)
+);
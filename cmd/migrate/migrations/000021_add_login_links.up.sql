@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS login_links
+(
+    token      bytea PRIMARY KEY,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expiry     TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    ip         VARCHAR(45)                 NOT NULL, -- address the link was requested from
+    user_agent TEXT                        NOT NULL, -- user agent the link was requested with
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_links_user_id ON login_links (user_id);
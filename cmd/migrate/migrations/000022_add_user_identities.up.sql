@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    provider   VARCHAR(50)                 NOT NULL,
+    subject    VARCHAR(255)                NOT NULL, -- ID of the user at the provider
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      citext                      NOT NULL, -- email the provider vouched for when the identity was linked
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+-- Logins in progress at a provider, between the redirect to it and the callback
+CREATE TABLE IF NOT EXISTS oidc_login_states
+(
+    state         bytea PRIMARY KEY,
+    provider      VARCHAR(50)                 NOT NULL,
+    nonce         VARCHAR(64)                 NOT NULL,
+    code_verifier VARCHAR(128)                NOT NULL,
+    expiry        TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    created_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id          BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- Roles held by each user, users.role_id remains their primary role
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id    BIGINT                      NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_role_id ON user_roles (role_id);
+
+INSERT INTO permissions (name, description)
+VALUES
+    ('post.update.any', 'Update posts of other users'),
+    ('post.delete.any', 'Delete posts of other users'),
+    ('comment.moderate', 'Update comments of other users'),
+    ('comment.delete.any', 'Delete comments of other users'),
+    ('user.unlock', 'Unlock accounts locked after failed logins'),
+    ('invitation.read', 'List accounts awaiting activation');
+
+-- Grant the permissions the role levels used to imply
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         JOIN permissions p ON (r.name = 'moderator' AND p.name IN ('post.update.any', 'comment.moderate'))
+    OR r.name = 'admin';
+
+INSERT INTO user_roles (user_id, role_id)
+SELECT id, role_id
+FROM users;
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'role.manage';
+
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    BIGINT REFERENCES users (id) ON DELETE SET NULL, -- user who made the change
+    action      VARCHAR(100)                NOT NULL,
+    target_type VARCHAR(50)                 NOT NULL,
+    target_id   VARCHAR(100)                NOT NULL,
+    data        JSONB                       NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id);
+
+INSERT INTO permissions (name, description)
+VALUES ('role.manage', 'Manage roles and the roles of users');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r,
+     permissions p
+WHERE r.name = 'admin'
+  AND p.name = 'role.manage';
@@ -0,0 +1,22 @@
+DELETE FROM permissions WHERE name = 'audit.read';
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS reject_audit_event_change();
+
+DROP INDEX IF EXISTS idx_audit_events_created_at;
+DROP INDEX IF EXISTS idx_audit_events_actor_id;
+
+ALTER TABLE audit_events
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS request_id;
+
+ALTER TABLE audit_events
+    RENAME COLUMN diff TO data;
+
+UPDATE audit_events
+SET actor_id = NULL
+WHERE actor_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE audit_events
+    ADD CONSTRAINT audit_events_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE SET NULL;
@@ -0,0 +1,44 @@
+-- Events outlive the users they mention, the actor is kept as a plain ID so that deleting a user does not rewrite
+-- the trail
+ALTER TABLE audit_events
+    DROP CONSTRAINT IF EXISTS audit_events_actor_id_fkey;
+
+ALTER TABLE audit_events
+    RENAME COLUMN data TO diff;
+
+ALTER TABLE audit_events
+    ADD COLUMN IF NOT EXISTS request_id VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ip         VARCHAR(45)  NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- The trail is append-only, events can be neither changed nor removed
+CREATE OR REPLACE FUNCTION reject_audit_event_change() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE
+    ON audit_events
+    FOR EACH ROW
+EXECUTE FUNCTION reject_audit_event_change();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE
+    ON audit_events
+    FOR EACH STATEMENT
+EXECUTE FUNCTION reject_audit_event_change();
+
+INSERT INTO permissions (name, description)
+VALUES ('audit.read', 'Query and export the audit trail');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r,
+     permissions p
+WHERE r.name = 'admin'
+  AND p.name = 'audit.read';
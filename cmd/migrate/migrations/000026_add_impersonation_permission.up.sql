@@ -0,0 +1,9 @@
+INSERT INTO permissions (name, description)
+VALUES ('user.impersonate', 'Act as another user to reproduce their issues');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r,
+     permissions p
+WHERE r.name = 'admin'
+  AND p.name = 'user.impersonate';
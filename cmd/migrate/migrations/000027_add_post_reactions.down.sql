@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS post_reactions_counts ON post_reactions;
+DROP FUNCTION IF EXISTS update_post_reaction_counts();
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS reaction_counts;
+
+DROP TABLE IF EXISTS post_reactions;
@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS post_reactions
+(
+    post_id    BIGINT                      NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type       VARCHAR(20)                 NOT NULL CHECK (type IN ('like', 'love', 'laugh', 'wow', 'sad', 'angry')),
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id, type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_reactions_post_type ON post_reactions (post_id, type, created_at);
+
+-- Number of reactions of each type, kept up to date by a trigger so that feeds do not aggregate reactions
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS reaction_counts JSONB NOT NULL DEFAULT '{}';
+
+CREATE OR REPLACE FUNCTION update_post_reaction_counts() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE posts
+        SET reaction_counts = jsonb_set(reaction_counts, ARRAY [NEW.type],
+                                        to_jsonb(COALESCE((reaction_counts ->> NEW.type)::BIGINT, 0) + 1))
+        WHERE id = NEW.post_id;
+    ELSE
+        -- The post is gone already when its reactions are deleted along with it, and nothing is updated then
+        UPDATE posts
+        SET reaction_counts = CASE
+                                  WHEN COALESCE((reaction_counts ->> OLD.type)::BIGINT, 0) <= 1
+                                      THEN reaction_counts - OLD.type
+                                  ELSE jsonb_set(reaction_counts, ARRAY [OLD.type],
+                                                 to_jsonb((reaction_counts ->> OLD.type)::BIGINT - 1))
+            END
+        WHERE id = OLD.post_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_reactions_counts
+    AFTER INSERT OR DELETE
+    ON post_reactions
+    FOR EACH ROW
+EXECUTE FUNCTION update_post_reaction_counts();
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS bookmark_collections
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       VARCHAR(100)                NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- Bookmarks go away with their post or collection
+CREATE TABLE IF NOT EXISTS bookmarks
+(
+    collection_id BIGINT                      NOT NULL REFERENCES bookmark_collections (id) ON DELETE CASCADE,
+    post_id       BIGINT                      NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    created_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (collection_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_post_id ON bookmarks (post_id);
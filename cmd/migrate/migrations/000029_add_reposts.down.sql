@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS posts_delete_reposts ON posts;
+DROP FUNCTION IF EXISTS delete_post_reposts();
+
+DELETE FROM posts WHERE kind = 'repost';
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS posts_kind_original_check,
+    DROP COLUMN IF EXISTS original_id,
+    DROP COLUMN IF EXISTS kind;
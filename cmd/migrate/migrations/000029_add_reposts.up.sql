@@ -0,0 +1,29 @@
+-- A post is either an original post, a plain repost of another post or a quote of another post with commentary
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS kind        VARCHAR(10) NOT NULL DEFAULT 'post' CHECK (kind IN ('post', 'repost', 'quote')),
+    -- Quotes keep their commentary when the original is deleted, with original_id set to NULL as a tombstone
+    ADD COLUMN IF NOT EXISTS original_id BIGINT REFERENCES posts (id) ON DELETE SET NULL;
+
+ALTER TABLE posts
+    ADD CONSTRAINT posts_kind_original_check CHECK (
+        (kind = 'post' AND original_id IS NULL) OR (kind = 'repost' AND original_id IS NOT NULL) OR kind = 'quote'
+        );
+
+-- A user reposts a post at most once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_reposts ON posts (original_id, user_id) WHERE kind = 'repost';
+CREATE INDEX IF NOT EXISTS idx_posts_original_id ON posts (original_id);
+
+-- Reposts have nothing of their own to keep, so they go away with the original instead of being tombstoned
+CREATE OR REPLACE FUNCTION delete_post_reposts() RETURNS TRIGGER AS
+$$
+BEGIN
+    DELETE FROM posts WHERE original_id = OLD.id AND kind = 'repost';
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_delete_reposts
+    BEFORE DELETE
+    ON posts
+    FOR EACH ROW
+EXECUTE FUNCTION delete_post_reposts();
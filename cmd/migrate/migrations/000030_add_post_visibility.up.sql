@@ -0,0 +1,5 @@
+-- Who can see a post: anyone, the followers of the author, only the author, or anyone with the link without the post
+-- showing up in feeds
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+        CHECK (visibility IN ('public', 'followers', 'private', 'unlisted'));
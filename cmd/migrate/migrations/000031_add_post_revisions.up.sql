@@ -0,0 +1,10 @@
+-- Previous versions of posts, written whenever a post is updated. The current version stays in posts.
+CREATE TABLE IF NOT EXISTS post_revisions
+(
+    post_id    BIGINT                      NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    version    INT                         NOT NULL,
+    title      TEXT                        NOT NULL,
+    content    TEXT                        NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL, -- when this version was written
+    PRIMARY KEY (post_id, version)
+);
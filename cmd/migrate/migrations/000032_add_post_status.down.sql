@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_posts_publish_at;
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS posts_publish_at_check,
+    DROP COLUMN IF EXISTS publish_at,
+    DROP COLUMN IF EXISTS status;
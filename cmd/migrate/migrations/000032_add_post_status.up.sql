@@ -0,0 +1,11 @@
+-- Drafts are only visible to their author, scheduled posts are published by the API workers once publish_at is due
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS status     VARCHAR(10) NOT NULL DEFAULT 'published'
+        CHECK (status IN ('draft', 'scheduled', 'published')),
+    ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP(0) WITH TIME ZONE;
+
+ALTER TABLE posts
+    ADD CONSTRAINT posts_publish_at_check CHECK (status <> 'scheduled' OR publish_at IS NOT NULL);
+
+-- Scheduled posts are picked by publication time, the only ones the workers look at
+CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts (publish_at) WHERE status = 'scheduled';
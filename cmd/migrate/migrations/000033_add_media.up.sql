@@ -0,0 +1,16 @@
+-- Uploads stay unattached until a post of their uploader claims them, and go back to unattached when the post is
+-- deleted, so that unattached uploads can be swept along with their blobs
+CREATE TABLE IF NOT EXISTS media
+(
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    post_id      BIGINT                      REFERENCES posts (id) ON DELETE SET NULL,
+    position     INT                         NOT NULL DEFAULT 0, -- Order of the file among those of its post
+    storage_key  VARCHAR(255)                NOT NULL UNIQUE,
+    content_type VARCHAR(100)                NOT NULL,
+    size         BIGINT                      NOT NULL,
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_post_id ON media (post_id);
+CREATE INDEX IF NOT EXISTS idx_media_unattached ON media (created_at) WHERE post_id IS NULL;
@@ -0,0 +1,27 @@
+-- Images are processed in the background before they are served: pending until then, failed if they cannot be decoded
+ALTER TABLE media
+    ADD COLUMN IF NOT EXISTS status     VARCHAR(20) NOT NULL DEFAULT 'ready'
+        CHECK (status IN ('pending', 'ready', 'failed')),
+    ADD COLUMN IF NOT EXISTS width      INT,
+    ADD COLUMN IF NOT EXISTS height     INT,
+    ADD COLUMN IF NOT EXISTS blurhash   VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS attempts   INT         NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- Process the images uploaded before
+UPDATE media SET status = 'pending' WHERE content_type IN ('image/jpeg', 'image/png', 'image/gif');
+
+CREATE INDEX IF NOT EXISTS idx_media_pending ON media (id) WHERE status = 'pending';
+
+-- Resized copies of images, such as thumbnails
+CREATE TABLE IF NOT EXISTS media_variants
+(
+    media_id     BIGINT       NOT NULL REFERENCES media (id) ON DELETE CASCADE,
+    name         VARCHAR(20)  NOT NULL,
+    storage_key  VARCHAR(255) NOT NULL UNIQUE,
+    content_type VARCHAR(100) NOT NULL,
+    width        INT          NOT NULL,
+    height       INT          NOT NULL,
+    size         BIGINT       NOT NULL,
+    PRIMARY KEY (media_id, name)
+);
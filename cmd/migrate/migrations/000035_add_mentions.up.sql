@@ -0,0 +1,33 @@
+-- Mentions of users in the content of posts and comments, resolved when the content is written. Mentions in a
+-- comment also record its post, whose visibility decides who can see them
+CREATE TABLE IF NOT EXISTS mentions
+(
+    id           BIGSERIAL PRIMARY KEY,
+    post_id      BIGINT                      NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    comment_id   BIGINT                      REFERENCES comments (id) ON DELETE CASCADE, -- NULL for mentions in the post
+    user_id      BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    start_offset INT                         NOT NULL, -- Offset of the @ sign in the content, in characters
+    end_offset   INT                         NOT NULL, -- Offset right after the username, in characters
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_post_id ON mentions (post_id);
+CREATE INDEX IF NOT EXISTS idx_mentions_comment_id ON mentions (comment_id);
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions (user_id);
+
+-- Notifications go away with their post or comment. A user is notified once of being mentioned in a post or comment,
+-- however many times the content is edited
+CREATE TABLE IF NOT EXISTS notifications
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type       VARCHAR(20)                 NOT NULL CHECK (type IN ('mention')),
+    actor_id   BIGINT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    post_id    BIGINT                      NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    comment_id BIGINT                      REFERENCES comments (id) ON DELETE CASCADE,
+    read_at    TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unique ON notifications (user_id, type, post_id, COALESCE(comment_id, 0));
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id, created_at);
@@ -0,0 +1 @@
+-- Processed files keep their stripped content, there is nothing to undo
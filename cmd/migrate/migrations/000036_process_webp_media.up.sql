@@ -0,0 +1,2 @@
+-- WebP images are processed to remove their EXIF and XMP chunks too, including those uploaded before
+UPDATE media SET status = 'pending' WHERE content_type = 'image/webp' AND status = 'ready';
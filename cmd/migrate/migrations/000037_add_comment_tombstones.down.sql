@@ -0,0 +1,10 @@
+-- Tombstones cannot be restored, they are removed along with their replies
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS comments_parent_id_fkey,
+    ADD CONSTRAINT comments_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+DELETE FROM comments WHERE deleted_at IS NOT NULL OR user_id IS NULL;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS deleted_at,
+    ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,8 @@
+-- Deleting a comment with replies leaves a tombstone in its place, without content or author, so the replies of
+-- other users stay in the thread. Only comments without replies are removed, so a reply no longer takes its parent
+-- down with it
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS comments_parent_id_fkey,
+    ADD CONSTRAINT comments_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES comments (id),
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP(0) WITH TIME ZONE;
@@ -0,0 +1 @@
+-- The permission granted nothing, there is nothing to restore
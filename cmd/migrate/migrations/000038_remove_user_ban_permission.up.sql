@@ -0,0 +1,2 @@
+-- No route checks user.ban, granting it did nothing. It goes away from the roles it was granted to as well
+DELETE FROM permissions WHERE name = 'user.ban';
@@ -2,14 +2,18 @@ package auth
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type JWTAuthenticator struct {
-	secret string // Secret key used for signing JWT tokens
-	aud    string // Audience for which the token is intended
-	iss    string // Issuer of the token
+	secret     string                      // Secret key used for signing JWT tokens with HS256
+	signingKey *SigningKey                 // Private key used for signing JWT tokens, replaces the secret when set
+	keys       map[string]*VerificationKey // Public keys accepted when validating tokens, by key ID
+	aud        string                      // Audience for which the token is intended
+	iss        string                      // Issuer of the token
 }
 
 // NewJWTAuthenticator creates a new JWTAuthenticator with the provided secret, audience, and issuer.
@@ -21,11 +25,35 @@ func NewJWTAuthenticator(secret, aud, iss string) *JWTAuthenticator {
 	}
 }
 
+// NewAsymmetricJWTAuthenticator creates a new JWTAuthenticator that signs tokens with a private key and accepts
+// tokens signed by it or by any of the additional verification keys. To rotate keys with no downtime, publish the new
+// key as a verification key first, then make it the signing key and keep the old one as a verification key until the
+// tokens it signed have expired.
+func NewAsymmetricJWTAuthenticator(signingKey *SigningKey, verificationKeys []*VerificationKey, aud, iss string) *JWTAuthenticator {
+	keys := map[string]*VerificationKey{signingKey.ID: signingKey.Public()}
+	for _, key := range verificationKeys {
+		keys[key.ID] = key
+	}
+
+	return &JWTAuthenticator{
+		signingKey: signingKey,
+		keys:       keys,
+		aud:        aud,
+		iss:        iss,
+	}
+}
+
 // GenerateToken generates a JWT token with the provided claims.
 func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if a.signingKey == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(a.secret))
+	}
+
+	token := jwt.NewWithClaims(a.signingKey.Method, claims)
+	token.Header["kid"] = a.signingKey.ID
 
-	tokenString, err := token.SignedString([]byte(a.secret))
+	tokenString, err := token.SignedString(a.signingKey.Key)
 	if err != nil {
 		return "", err
 	}
@@ -35,17 +63,46 @@ func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 
 // ValidateToken validates the provided JWT token and returns the parsed token if valid.
 func (a *JWTAuthenticator) ValidateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		// Ensure the token's signing method is valid
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(a.secret), nil
-	},
-		// Options for parsing the token
+	// Options for parsing the token
+	options := []jwt.ParserOption{
 		jwt.WithExpirationRequired(),
 		jwt.WithAudience(a.aud),
 		jwt.WithIssuer(a.iss),
-		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
-	)
+	}
+
+	if a.signingKey == nil {
+		options = append(options, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+		return jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+			// Ensure the token's signing method is valid
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(a.secret), nil
+		}, options...)
+	}
+
+	options = append(options, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+	return jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		// Look up the key the token was signed with, and ensure it is used with its own signing method
+		kid, _ := token.Header["kid"].(string)
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID: %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.Key, nil
+	}, options...)
+}
+
+// JWKS returns the public keys tokens are verified with. It is empty when tokens are signed with a shared secret.
+func (a *JWTAuthenticator) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range a.keys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	slices.SortFunc(jwks.Keys, func(x, y JWK) int { return strings.Compare(x.Kid, y.Kid) })
+
+	return jwks
 }
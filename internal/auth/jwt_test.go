@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAsymmetricJWTAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	oldKey := loadTestSigningKey(t, writeTestKey(t, dir, "old.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)))
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal Ed25519 key: %v", err)
+	}
+	newKey := loadTestSigningKey(t, writeTestKey(t, dir, "new.pem", "PRIVATE KEY", edDER))
+
+	publicDER, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	if err != nil {
+		t.Fatalf("Failed to marshal RSA public key: %v", err)
+	}
+	oldPublic, err := LoadVerificationKey(writeTestKey(t, dir, "old.pub.pem", "PUBLIC KEY", publicDER))
+	if err != nil {
+		t.Fatalf("Failed to load verification key: %v", err)
+	}
+	if oldPublic.ID != oldKey.ID {
+		t.Fatalf("expected public key ID %s to match private key ID %s", oldPublic.ID, oldKey.ID)
+	}
+
+	claims := jwt.MapClaims{"sub": 1, "aud": "test", "iss": "test", "exp": time.Now().Add(time.Hour).Unix()}
+
+	before := NewAsymmetricJWTAuthenticator(oldKey, nil, "test", "test")
+	after := NewAsymmetricJWTAuthenticator(newKey, []*VerificationKey{oldPublic}, "test", "test")
+
+	oldToken, err := before.GenerateToken(claims)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	newToken, err := after.GenerateToken(claims)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	t.Run("should set the key ID header", func(t *testing.T) {
+		token, err := after.ValidateToken(newToken)
+		if err != nil {
+			t.Fatalf("expected token to be valid: %v", err)
+		}
+		if token.Header["kid"] != newKey.ID || token.Method.Alg() != "EdDSA" {
+			t.Errorf("unexpected header %v", token.Header)
+		}
+	})
+
+	t.Run("should accept tokens signed by a rotated key", func(t *testing.T) {
+		if _, err := after.ValidateToken(oldToken); err != nil {
+			t.Errorf("expected token signed with the old key to be valid: %v", err)
+		}
+	})
+
+	t.Run("should reject tokens signed by an unknown key", func(t *testing.T) {
+		if _, err := before.ValidateToken(newToken); err == nil {
+			t.Error("expected token signed with an unknown key to be rejected")
+		}
+	})
+
+	t.Run("should reject tokens signed with the shared secret", func(t *testing.T) {
+		hmacToken, err := NewJWTAuthenticator("secret", "test", "test").GenerateToken(claims)
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+		if _, err := after.ValidateToken(hmacToken); err == nil {
+			t.Error("expected HS256 token to be rejected")
+		}
+	})
+
+	t.Run("should publish every active key", func(t *testing.T) {
+		jwks := after.JWKS()
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("expected 2 keys, got %d", len(jwks.Keys))
+		}
+		for _, key := range jwks.Keys {
+			if key.Use != "sig" || (key.Kty == "RSA" && key.N == "") || (key.Kty == "OKP" && key.X == "") {
+				t.Errorf("unexpected key %+v", key)
+			}
+		}
+	})
+}
+
+func writeTestKey(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	return path
+}
+
+func loadTestSigningKey(t *testing.T, path string) *SigningKey {
+	t.Helper()
+
+	key, err := LoadSigningKey(path)
+	if err != nil {
+		t.Fatalf("Failed to load signing key: %v", err)
+	}
+
+	return key
+}
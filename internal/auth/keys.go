@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnsupportedKey is returned when a PEM file holds a key type that cannot be used to sign tokens.
+var ErrUnsupportedKey = errors.New("unsupported key type, expected an RSA or Ed25519 key")
+
+// SigningKey is a private key used to sign tokens, identified by its key ID.
+type SigningKey struct {
+	ID     string            // Key ID, set as the kid header of the tokens
+	Method jwt.SigningMethod // RS256 for RSA keys, EdDSA for Ed25519 keys
+	Key    crypto.Signer
+}
+
+// VerificationKey is a public key accepted when validating tokens.
+type VerificationKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.PublicKey
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA public exponent
+	Crv string `json:"crv,omitempty"` // Curve of an OKP key
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS is a set of public keys, as served to the services that verify tokens.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadSigningKey reads an RSA or Ed25519 private key from a PEM file. The key ID is the RFC 7638 thumbprint of the
+// public key, so every service derives the same ID from the same key.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	public, err := newVerificationKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{ID: public.ID, Method: public.Method, Key: signer}, nil
+}
+
+// LoadVerificationKey reads an RSA or Ed25519 public key from a PEM file. A private key is accepted too, in which
+// case its public part is used.
+func LoadVerificationKey(path string) (*VerificationKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type != "PUBLIC KEY" {
+		signing, err := LoadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return signing.Public(), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return newVerificationKey(key)
+}
+
+// Public returns the verification key matching the signing key.
+func (k *SigningKey) Public() *VerificationKey {
+	return &VerificationKey{ID: k.ID, Method: k.Method, Key: k.Key.Public()}
+}
+
+// JWK returns the key in the JSON Web Key format.
+func (k *VerificationKey) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+
+	switch key := k.Key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	}
+
+	return jwk
+}
+
+// newVerificationKey wraps a public key with its signing method and key ID.
+func newVerificationKey(key crypto.PublicKey) (*VerificationKey, error) {
+	k := &VerificationKey{Key: key}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits long")
+		}
+		k.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	k.ID = thumbprint(k.JWK())
+	return k, nil
+}
+
+// thumbprint computes the RFC 7638 thumbprint of a key, the hash of its required members in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members any
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	// Marshalling plain strings of base64url characters cannot fail
+	b, _ := json.Marshal(members)
+	hash := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// readPEM reads the first PEM block of a file.
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	return block, nil
+}
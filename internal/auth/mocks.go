@@ -12,6 +12,7 @@ var testClaims = jwt.MapClaims{
 	"aud": "test-aud",
 	"iss": "test-iss",
 	"sub": int64(251),
+	"sid": "6f1c2d3e-4b5a-4c7d-8e9f-0a1b2c3d4e5f",
 	"exp": time.Now().Add(time.Hour * 24).Unix(),
 }
 
@@ -28,3 +29,7 @@ func (t *TestAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 		return []byte("secret"), nil
 	})
 }
+
+func (t *TestAuthenticator) JWKS() JWKS {
+	return JWKS{Keys: []JWK{}}
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Endpoints operators can be granted access to
+const (
+	OperatorEndpointHealth  = "health"
+	OperatorEndpointMetrics = "metrics"
+)
+
+// Default credentials of the operator configured from the environment, refused in production
+const (
+	DefaultOperatorUsername = "admin"
+	DefaultOperatorPassword = "admin"
+)
+
+// ErrUnsupportedHash is returned when a password hash is neither bcrypt nor argon2id.
+var ErrUnsupportedHash = errors.New("unsupported password hash, use bcrypt or argon2id")
+
+// Operator is an account allowed to reach operational endpoints such as health checks and metrics.
+type Operator struct {
+	Username     string         // Name the operator authenticates with
+	Endpoints    []string       // Endpoints the operator may access
+	AllowedCIDRs []netip.Prefix // Networks the operator may connect from, any when empty
+
+	hash string // bcrypt or argon2id hash of the password
+}
+
+// Operators is a set of operator accounts, keyed by username.
+type Operators struct {
+	accounts map[string]*Operator
+}
+
+// operatorFile is the JSON form of an operator in an operators file.
+type operatorFile struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"password_hash"`
+	Endpoints    []string `json:"endpoints"`
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+}
+
+// dummyHash is compared against when the username is unknown, so that the response time does not tell whether an
+// operator exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// LoadOperators reads operator accounts from a JSON file holding an array of objects with a username, a bcrypt or
+// argon2id password_hash, the endpoints they may access and an optional allowed_cidrs list.
+func LoadOperators(path string) (*Operators, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []operatorFile
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing operators file: %w", err)
+	}
+
+	ops := &Operators{accounts: make(map[string]*Operator, len(entries))}
+	for _, entry := range entries {
+		if entry.Username == "" {
+			return nil, fmt.Errorf("operator without a username")
+		}
+		if _, ok := ops.accounts[entry.Username]; ok {
+			return nil, fmt.Errorf("duplicate operator %q", entry.Username)
+		}
+		if !isSupportedHash(entry.PasswordHash) {
+			return nil, fmt.Errorf("operator %q: %w", entry.Username, ErrUnsupportedHash)
+		}
+
+		for _, endpoint := range entry.Endpoints {
+			if endpoint != OperatorEndpointHealth && endpoint != OperatorEndpointMetrics {
+				return nil, fmt.Errorf("operator %q: unknown endpoint %q", entry.Username, endpoint)
+			}
+		}
+
+		operator := &Operator{Username: entry.Username, Endpoints: entry.Endpoints, hash: entry.PasswordHash}
+		for _, cidr := range entry.AllowedCIDRs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("operator %q: %w", entry.Username, err)
+			}
+			operator.AllowedCIDRs = append(operator.AllowedCIDRs, prefix.Masked())
+		}
+
+		ops.accounts[entry.Username] = operator
+	}
+
+	return ops, nil
+}
+
+// NewOperator creates a set with a single operator with access to every endpoint from anywhere, for setups
+// configured from the environment. The password is hashed right away.
+func NewOperator(username, password string) (*Operators, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	operator := &Operator{
+		Username:  username,
+		Endpoints: []string{OperatorEndpointHealth, OperatorEndpointMetrics},
+		hash:      string(hash),
+	}
+
+	return &Operators{accounts: map[string]*Operator{username: operator}}, nil
+}
+
+// Authenticate returns the operator with the given credentials, or false if they are invalid. The password is
+// compared in constant time, and an unknown username costs as much as a wrong password.
+func (o *Operators) Authenticate(username, password string) (*Operator, bool) {
+	operator, ok := o.accounts[username]
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, false
+	}
+
+	if !verifyPassword(operator.hash, password) {
+		return nil, false
+	}
+
+	return operator, true
+}
+
+// HasDefaultCredentials reports whether any operator can authenticate with the default credentials.
+func (o *Operators) HasDefaultCredentials() bool {
+	_, ok := o.Authenticate(DefaultOperatorUsername, DefaultOperatorPassword)
+	return ok
+}
+
+// Allows reports whether the operator may access an endpoint from an IP address.
+func (op *Operator) Allows(endpoint string, ip netip.Addr) bool {
+	if !slices.Contains(op.Endpoints, endpoint) {
+		return false
+	}
+
+	if len(op.AllowedCIDRs) == 0 {
+		return true
+	}
+
+	ip = ip.Unmap()
+	return slices.ContainsFunc(op.AllowedCIDRs, func(prefix netip.Prefix) bool {
+		return prefix.Contains(ip)
+	})
+}
+
+// isSupportedHash reports whether a hash is in a format verifyPassword understands.
+func isSupportedHash(hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, _, _, err := parseArgon2id(hash)
+		return err == nil
+	}
+
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// verifyPassword checks a password against a bcrypt or argon2id hash.
+func verifyPassword(hash, password string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	derived := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
+
+// argon2Params holds the cost parameters of an argon2id hash.
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// parseArgon2id decodes a hash in the PHC string format, $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>, with the salt
+// and key in unpadded base64.
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	// argon2.IDKey panics without rounds or threads, and the algorithm needs 8 KB of memory per thread
+	if params.time < 1 || params.threads < 1 || params.memory < 8*uint32(params.threads) {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOperators(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("argon-secret"), salt, 1, 64*1024, 1, 32)
+	argonHash := fmt.Sprintf("$argon2id$v=%d$m=65536,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	path := filepath.Join(t.TempDir(), "operators.json")
+	data := fmt.Sprintf(`[
+		{"username": "monitoring", "password_hash": %q, "endpoints": ["health"], "allowed_cidrs": ["10.0.0.0/8"]},
+		{"username": "sre", "password_hash": %q, "endpoints": ["health", "metrics"]}
+	]`, bcryptHash, argonHash)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := LoadOperators(path)
+	if err != nil {
+		t.Fatalf("Failed to load operators: %v", err)
+	}
+
+	t.Run("should authenticate bcrypt and argon2id hashes", func(t *testing.T) {
+		if _, ok := ops.Authenticate("monitoring", "bcrypt-secret"); !ok {
+			t.Error("expected bcrypt operator to authenticate")
+		}
+		if _, ok := ops.Authenticate("sre", "argon-secret"); !ok {
+			t.Error("expected argon2id operator to authenticate")
+		}
+	})
+
+	t.Run("should reject wrong credentials", func(t *testing.T) {
+		if _, ok := ops.Authenticate("monitoring", "argon-secret"); ok {
+			t.Error("expected wrong password to be rejected")
+		}
+		if _, ok := ops.Authenticate("sre", "bcrypt-secret"); ok {
+			t.Error("expected wrong password to be rejected")
+		}
+		if _, ok := ops.Authenticate("nobody", "bcrypt-secret"); ok {
+			t.Error("expected unknown operator to be rejected")
+		}
+	})
+
+	t.Run("should restrict endpoints and networks", func(t *testing.T) {
+		monitoring, _ := ops.Authenticate("monitoring", "bcrypt-secret")
+		inside, outside := netip.MustParseAddr("10.1.2.3"), netip.MustParseAddr("192.168.1.1")
+
+		if !monitoring.Allows(OperatorEndpointHealth, inside) {
+			t.Error("expected health to be allowed from the allowed network")
+		}
+		if !monitoring.Allows(OperatorEndpointHealth, netip.MustParseAddr("::ffff:10.1.2.3")) {
+			t.Error("expected IPv4-mapped addresses to match IPv4 networks")
+		}
+		if monitoring.Allows(OperatorEndpointHealth, outside) {
+			t.Error("expected health to be denied from another network")
+		}
+		if monitoring.Allows(OperatorEndpointMetrics, inside) {
+			t.Error("expected metrics to be denied")
+		}
+
+		sre, _ := ops.Authenticate("sre", "argon-secret")
+		if !sre.Allows(OperatorEndpointMetrics, outside) {
+			t.Error("expected an operator without allow-list to connect from anywhere")
+		}
+	})
+
+	t.Run("should detect the default credentials", func(t *testing.T) {
+		if ops.HasDefaultCredentials() {
+			t.Error("expected no default credentials")
+		}
+
+		defaults, err := NewOperator(DefaultOperatorUsername, DefaultOperatorPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !defaults.HasDefaultCredentials() {
+			t.Error("expected default credentials to be detected")
+		}
+	})
+
+	t.Run("should refuse plaintext passwords", func(t *testing.T) {
+		plain := filepath.Join(t.TempDir(), "plain.json")
+		if err := os.WriteFile(plain, []byte(`[{"username": "ops", "password_hash": "admin", "endpoints": ["health"]}]`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadOperators(plain); err == nil {
+			t.Error("expected a plaintext password to be refused")
+		}
+	})
+
+	t.Run("should refuse argon2id hashes with invalid parameters", func(t *testing.T) {
+		encodedSalt, encodedKey := base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)
+		hashes := []string{
+			fmt.Sprintf("$argon2id$v=%d$m=65536,t=0,p=1$%s$%s", argon2.Version, encodedSalt, encodedKey),
+			fmt.Sprintf("$argon2id$v=%d$m=65536,t=1,p=0$%s$%s", argon2.Version, encodedSalt, encodedKey),
+			fmt.Sprintf("$argon2id$v=%d$m=15,t=1,p=2$%s$%s", argon2.Version, encodedSalt, encodedKey),
+			fmt.Sprintf("$argon2id$v=%d$m=65536,t=1,p=1$$%s", argon2.Version, encodedKey),
+		}
+
+		for _, hash := range hashes {
+			file := filepath.Join(t.TempDir(), "operators.json")
+			data := fmt.Sprintf(`[{"username": "admin", "password_hash": %q, "endpoints": ["health"]}]`, hash)
+			if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := LoadOperators(file); err == nil {
+				t.Errorf("expected %s to be refused", hash)
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B (SHA1), truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("expected code %s to be valid at %d", tt.code, tt.unix)
+			continue
+		}
+		if step != tt.unix/totpPeriod {
+			t.Errorf("expected step %d, got %d", tt.unix/totpPeriod, step)
+		}
+	}
+
+	t.Run("should accept the previous period", func(t *testing.T) {
+		if _, ok := ValidateTOTP(secret, "287082", time.Unix(59+totpPeriod, 0)); !ok {
+			t.Error("expected code from the previous period to be valid")
+		}
+	})
+
+	t.Run("should reject an expired code", func(t *testing.T) {
+		if _, ok := ValidateTOTP(secret, "287082", time.Unix(59+3*totpPeriod, 0)); ok {
+			t.Error("expected code to be rejected")
+		}
+	})
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	ciphertext, err := Encrypt(key, []byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	plaintext, err := Decrypt(key, ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if string(plaintext) != "secret" {
+		t.Errorf("expected %q, got %q", "secret", plaintext)
+	}
+
+	ciphertext[len(ciphertext)-1] ^= 0xff
+	if _, err := Decrypt(key, ciphertext); err == nil {
+		t.Error("expected tampered ciphertext to be rejected")
+	}
+}
@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 func GetString(key string, defaultValue string) string {
@@ -41,3 +42,17 @@ func GetBool(key string, defaultValue bool) bool {
 
 	return boolVal
 }
+
+func GetDuration(key string, defaultValue time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok || val == "" {
+		return defaultValue
+	}
+
+	durationVal, err := time.ParseDuration(val)
+	if err != nil {
+		return defaultValue
+	}
+
+	return durationVal
+}
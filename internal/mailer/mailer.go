@@ -3,9 +3,12 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "SocialApp"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName              = "SocialApp"
+	maxRetries            = 3
+	UserWelcomeTemplate   = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
+	AccountLockedTemplate = "account_locked.tmpl"
+	MagicLinkTemplate     = "magic_link.tmpl"
 )
 
 //go:embed "templates"
@@ -0,0 +1,34 @@
+// Package media stores the files users attach to posts.
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when no blob is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps the content of uploaded files, addressed by key.
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any previous content.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the content stored under key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the content stored under key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewKey returns a new random key, prefixed with the current date so that stored files are spread over directories.
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return time.Now().UTC().Format("2006/01/02/") + hex.EncodeToString(b), nil
+}
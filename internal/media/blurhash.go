@@ -0,0 +1,116 @@
+package media
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// base83 is the alphabet of blurhash strings
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes an image as a short blurhash string, which clients decode into a blurred placeholder while the
+// image loads. The image is described by xComponents by yComponents cosine components, 1 to 9 each. Images should
+// be downscaled first, every pixel is visited for each component.
+func Blurhash(img image.Image, xComponents, yComponents int) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Linear RGB of every pixel, visited once per component
+	pixels := make([][3]float64, 0, width*height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			pixels = append(pixels, [3]float64{srgbToLinear(r >> 8), srgbToLinear(g >> 8), srgbToLinear(b >> 8)})
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for cy := 0; cy < yComponents; cy++ {
+		for cx := 0; cx < xComponents; cx++ {
+			normalisation := 2.0
+			if cx == 0 && cy == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation * math.Cos(math.Pi*float64(cx*x)/float64(width)) *
+						math.Cos(math.Pi*float64(cy*y)/float64(height))
+					pixel := pixels[y*width+x]
+					for c := range factor {
+						factor[c] += basis * pixel[c]
+					}
+				}
+			}
+			for c := range factor {
+				factor[c] /= float64(width * height)
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+	encode83(&hash, (xComponents-1)+(yComponents-1)*9, 1)
+
+	// The AC components are quantised relative to the largest of them
+	dc, ac := factors[0], factors[1:]
+	maximum := 1.0
+	if len(ac) > 0 {
+		var actualMaximum float64
+		for _, factor := range ac {
+			for _, v := range factor {
+				actualMaximum = max(actualMaximum, math.Abs(v))
+			}
+		}
+		quantisedMaximum := int(max(0, min(82, math.Floor(actualMaximum*166-0.5))))
+		maximum = float64(quantisedMaximum+1) / 166
+		encode83(&hash, quantisedMaximum, 1)
+	} else {
+		encode83(&hash, 0, 1)
+	}
+
+	encode83(&hash, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, factor := range ac {
+		var quantised [3]int
+		for c, v := range factor {
+			quantised[c] = int(max(0, min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encode83(&hash, quantised[0]*19*19+quantised[1]*19+quantised[2], 2)
+	}
+
+	return hash.String()
+}
+
+// encode83 writes a value as length base 83 digits.
+func encode83(sb *strings.Builder, value, length int) {
+	divisor := 1
+	for i := 1; i < length; i++ {
+		divisor *= 83
+	}
+	for ; divisor > 0; divisor /= 83 {
+		sb.WriteByte(base83[value/divisor%83])
+	}
+}
+
+func srgbToLinear(v uint32) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = max(0, min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+// signPow raises the magnitude of v to exp, keeping its sign.
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
@@ -0,0 +1,349 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"slices"
+)
+
+// Limits on the images that get processed, so that small files describing huge images cannot exhaust the memory
+const (
+	maxImagePixels = 50_000_000 // 50 megapixels
+	maxGIFFrames   = 500
+	maxGIFPixels   = 200_000_000 // Sum of the areas of the frames of an animation, decoded at a byte per pixel
+)
+
+// jpegQuality is the quality of the JPEG files written when processing images
+const jpegQuality = 85
+
+// blurhashSize is the size images are scaled down to before computing their blurhash
+const blurhashSize = 32
+
+// ThumbnailSizes are the names and sizes of the thumbnails made of images. A thumbnail fits in a square of its size
+// and keeps the aspect ratio of the image. Images are never scaled up, so small images have fewer thumbnails.
+var ThumbnailSizes = []struct {
+	Name string
+	Size int
+}{
+	{"small", 320},
+	{"medium", 640},
+	{"large", 1280},
+}
+
+// ErrUnsupportedImage is returned when processing an image that cannot be decoded.
+var ErrUnsupportedImage = errors.New("unsupported or corrupted image")
+
+// processableTypes are the types of the images ProcessImage handles
+var processableTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// IsProcessable reports whether files of a type are processed by ProcessImage before they are served.
+func IsProcessable(contentType string) bool {
+	return slices.Contains(processableTypes, contentType)
+}
+
+// Image is an uploaded image made safe to serve.
+type Image struct {
+	Content    []byte    // Image without its metadata, in its original format
+	Width      int       // Width of the image as displayed, after applying its EXIF orientation
+	Height     int       // Height of the image as displayed, after applying its EXIF orientation
+	Blurhash   string    // Placeholder to show while the image loads, empty for WebP images
+	Thumbnails []Variant // Smaller copies of the image, from the smallest, none for WebP images
+}
+
+// Variant is a resized copy of an image.
+type Variant struct {
+	Name        string
+	Content     []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// ProcessImage decodes a JPEG, PNG or GIF image and strips the metadata that could reveal where and by whom it was
+// taken, such as EXIF locations. JPEG and PNG files are kept as they are otherwise, unless a JPEG needs rotating to
+// drop its EXIF orientation. GIF files are written again. It also makes the thumbnails and the blurhash of the image,
+// from the first frame of animations. WebP images, which the standard library cannot decode, only have their EXIF and
+// XMP chunks removed.
+func ProcessImage(data []byte, contentType string) (*Image, error) {
+	if contentType == "image/webp" {
+		content, width, height, err := stripWebP(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+		}
+		if width*height > maxImagePixels {
+			return nil, fmt.Errorf("%w: %dx%d pixels is too large", ErrUnsupportedImage, width, height)
+		}
+		return &Image{Content: content, Width: width, Height: height}, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels is too large", ErrUnsupportedImage, cfg.Width, cfg.Height)
+	}
+
+	var content []byte
+	var img image.Image
+	switch contentType {
+	case "image/jpeg":
+		var orientation int
+		content, orientation, err = stripJPEG(data)
+		if err != nil {
+			break
+		}
+		if img, err = jpeg.Decode(bytes.NewReader(content)); err != nil || orientation == 1 {
+			break
+		}
+		// Keep the orientation, which was only stored in the stripped metadata, by rotating the pixels
+		img = orient(img, orientation)
+		content, err = encodeJPEG(img)
+	case "image/png":
+		if content, err = stripPNG(data); err == nil {
+			img, err = png.Decode(bytes.NewReader(content))
+		}
+	case "image/gif":
+		content, img, err = rewriteGIF(data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedImage, contentType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+
+	// Work on premultiplied RGBA pixels, which draw converts to quickly from the decoded formats
+	pixels := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(pixels, pixels.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	processed := &Image{
+		Content:  content,
+		Width:    pixels.Bounds().Dx(),
+		Height:   pixels.Bounds().Dy(),
+		Blurhash: Blurhash(resize(pixels, fit(pixels.Bounds(), blurhashSize)), 4, 3),
+	}
+
+	for i, size := range ThumbnailSizes {
+		// Keep the smallest thumbnail of small images, at their size
+		if i > 0 && max(processed.Width, processed.Height) <= size.Size {
+			break
+		}
+
+		thumbnail := resize(pixels, fit(pixels.Bounds(), size.Size))
+		variant := Variant{Name: size.Name, Width: thumbnail.Bounds().Dx(), Height: thumbnail.Bounds().Dy()}
+		if thumbnail.Opaque() {
+			variant.ContentType = "image/jpeg"
+			variant.Content, err = encodeJPEG(thumbnail)
+		} else {
+			variant.ContentType = "image/png"
+			variant.Content, err = encodePNG(thumbnail)
+		}
+		if err != nil {
+			return nil, err
+		}
+		processed.Thumbnails = append(processed.Thumbnails, variant)
+	}
+
+	return processed, nil
+}
+
+// rewriteGIF decodes every frame of a GIF file and encodes them again, which drops the comments and application
+// data, and returns the first frame as it is displayed. The frames are counted and measured before any is decoded.
+func rewriteGIF(data []byte) ([]byte, image.Image, error) {
+	frames, pixels, err := gifFrames(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if frames > maxGIFFrames {
+		return nil, nil, fmt.Errorf("%d frames is too many", frames)
+	}
+	if pixels > maxGIFPixels {
+		return nil, nil, fmt.Errorf("%d pixels in all frames is too many", pixels)
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// XMP metadata is stored in an application extension, which the encoder does not write back
+	var out bytes.Buffer
+	if err := gif.EncodeAll(&out, g); err != nil {
+		return nil, nil, err
+	}
+
+	first := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	draw.Draw(first, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+
+	return out.Bytes(), first, nil
+}
+
+// gifFrames walks the blocks of a GIF file without decompressing them, and returns the number of frames and the sum
+// of their areas.
+func gifFrames(data []byte) (int, int, error) {
+	// Header and logical screen descriptor, followed by the global color table if there is one
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return 0, 0, errMalformedImage
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skipSubBlocks moves past a sequence of data sub-blocks ending with an empty one
+	skipSubBlocks := func() error {
+		for {
+			if i >= len(data) {
+				return errMalformedImage
+			}
+			size := int(data[i])
+			i += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	frames, pixels := 0, 0
+	for {
+		if i >= len(data) {
+			return 0, 0, errMalformedImage
+		}
+		switch data[i] {
+		case 0x21: // extension, with its label
+			i += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+		case 0x2C: // image descriptor, with its local color table and the minimum LZW code size
+			if i+10 > len(data) {
+				return 0, 0, errMalformedImage
+			}
+			width := int(binary.LittleEndian.Uint16(data[i+5:]))
+			height := int(binary.LittleEndian.Uint16(data[i+7:]))
+			frames++
+			pixels += width * height
+
+			packed := data[i+9]
+			i += 10
+			if packed&0x80 != 0 {
+				i += 3 << (packed&0x07 + 1)
+			}
+			i++
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+		case 0x3B: // trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, errMalformedImage
+		}
+	}
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// fit returns the size of an image scaled down to fit in a square, keeping its aspect ratio.
+func fit(bounds image.Rectangle, size int) image.Point {
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return image.Pt(width, height)
+	}
+	if width >= height {
+		return image.Pt(size, max(1, height*size/width))
+	}
+	return image.Pt(max(1, width*size/height), size)
+}
+
+// resize scales an image down to the given size by averaging the pixels each pixel of the result covers.
+func resize(src *image.RGBA, size image.Point) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	for y := 0; y < size.Y; y++ {
+		y0, y1 := y*sh/size.Y, max((y+1)*sh/size.Y, y*sh/size.Y+1)
+		for x := 0; x < size.X; x++ {
+			x0, x1 := x*sw/size.X, max((x+1)*sw/size.X, x*sw/size.X+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for c := range sum {
+				dst.Pix[offset+c] = uint8((sum[c] + count/2) / count)
+			}
+		}
+	}
+
+	return dst
+}
+
+// orient turns an image the way its EXIF orientation, from 2 to 8, tells it is displayed.
+func orient(src image.Image, orientation int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations from 5 on swap the width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90° counterclockwise
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.Set(x, y, src.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
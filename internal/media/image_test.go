@@ -0,0 +1,229 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// newTestImage returns an image of the given size filled with a color
+func newTestImage(width, height int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// exifSegment returns a JPEG APP1 segment with an EXIF orientation, followed by a fake GPS payload
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)                       // one entry
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01) // orientation, SHORT, count 1
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00) // padding and no next directory
+	tiff = append(tiff, "GPS 48.8584N 2.2945E"...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// pngChunk returns a PNG chunk of the given type
+func pngChunk(kind string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(append([]byte(kind), data...)))
+}
+
+// riffChunk returns a RIFF chunk of the given type, padded to an even size
+func riffChunk(kind string, data []byte) []byte {
+	chunk := append([]byte(kind), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpFile returns a WebP file made of the given chunks
+func webpFile(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func TestProcessImage(t *testing.T) {
+	t.Run("should strip EXIF from JPEG files and apply their orientation", func(t *testing.T) {
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, newTestImage(200, 100, color.White), nil); err != nil {
+			t.Fatal(err)
+		}
+		// Insert the EXIF segment right after the start of image
+		data := append(append(encoded.Bytes()[:2:2], exifSegment(6)...), encoded.Bytes()[2:]...)
+
+		processed, err := ProcessImage(data, "image/jpeg")
+		if err != nil {
+			t.Fatalf("Failed to process image: %v", err)
+		}
+		if bytes.Contains(processed.Content, []byte("Exif")) || bytes.Contains(processed.Content, []byte("GPS")) {
+			t.Error("expected EXIF data to be stripped")
+		}
+		if processed.Width != 100 || processed.Height != 200 {
+			t.Errorf("expected a rotated 100x200 image, got %dx%d", processed.Width, processed.Height)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(processed.Content)); err != nil {
+			t.Errorf("expected a valid JPEG file, got %v", err)
+		}
+	})
+
+	t.Run("should keep JPEG files without orientation as they are", func(t *testing.T) {
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, newTestImage(20, 10, color.White), nil); err != nil {
+			t.Fatal(err)
+		}
+		data := append(append(encoded.Bytes()[:2:2], exifSegment(1)...), encoded.Bytes()[2:]...)
+
+		processed, err := ProcessImage(data, "image/jpeg")
+		if err != nil {
+			t.Fatalf("Failed to process image: %v", err)
+		}
+		if !bytes.Equal(processed.Content, encoded.Bytes()) {
+			t.Error("expected only the EXIF segment to be removed")
+		}
+	})
+
+	t.Run("should strip text chunks from PNG files", func(t *testing.T) {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, newTestImage(20, 10, color.Transparent)); err != nil {
+			t.Fatal(err)
+		}
+		// Insert a text chunk after the header chunk, which is 25 bytes long
+		header := encoded.Bytes()[:8+25]
+		data := append(append(append([]byte{}, header...), pngChunk("tEXt", []byte("Author\x00Jane Doe"))...), encoded.Bytes()[len(header):]...)
+
+		processed, err := ProcessImage(data, "image/png")
+		if err != nil {
+			t.Fatalf("Failed to process image: %v", err)
+		}
+		if !bytes.Equal(processed.Content, encoded.Bytes()) {
+			t.Error("expected only the text chunk to be removed")
+		}
+		if len(processed.Thumbnails) != 1 || processed.Thumbnails[0].ContentType != "image/png" {
+			t.Errorf("expected a PNG thumbnail keeping the transparency, got %+v", processed.Thumbnails)
+		}
+	})
+
+	t.Run("should process the first frame of GIF files", func(t *testing.T) {
+		frame := image.NewPaletted(image.Rect(0, 0, 40, 30), color.Palette{color.Black, color.White})
+		var encoded bytes.Buffer
+		if err := gif.EncodeAll(&encoded, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}}); err != nil {
+			t.Fatal(err)
+		}
+
+		processed, err := ProcessImage(encoded.Bytes(), "image/gif")
+		if err != nil {
+			t.Fatalf("Failed to process image: %v", err)
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(processed.Content))
+		if err != nil || len(g.Image) != 2 {
+			t.Errorf("expected an animation of 2 frames, got %v", err)
+		}
+	})
+
+	t.Run("should refuse animations too large to decode before decoding them", func(t *testing.T) {
+		// A 7000x7000 screen, under the size limit of images, with frames covering all of it
+		data := []byte("GIF89a\x58\x1b\x58\x1b\x00\x00\x00")
+		for range 5 {
+			data = append(data, 0x2C, 0, 0, 0, 0, 0x58, 0x1b, 0x58, 0x1b, 0x00, 0x02, 0x00)
+		}
+		data = append(data, 0x3B)
+
+		_, err := ProcessImage(data, "image/gif")
+		if !errors.Is(err, ErrUnsupportedImage) || !strings.Contains(err.Error(), "pixels in all frames") {
+			t.Errorf("expected the animation to be refused for its size, got %v", err)
+		}
+	})
+
+	t.Run("should make thumbnails no larger than the image", func(t *testing.T) {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, newTestImage(2000, 1000, color.White)); err != nil {
+			t.Fatal(err)
+		}
+
+		processed, err := ProcessImage(encoded.Bytes(), "image/png")
+		if err != nil {
+			t.Fatalf("Failed to process image: %v", err)
+		}
+
+		expected := []string{"small 320x160", "medium 640x320", "large 1280x640"}
+		var got []string
+		for _, thumbnail := range processed.Thumbnails {
+			got = append(got, fmt.Sprintf("%s %dx%d", thumbnail.Name, thumbnail.Width, thumbnail.Height))
+			if thumbnail.ContentType != "image/jpeg" {
+				t.Errorf("expected JPEG thumbnails of opaque images, got %q", thumbnail.ContentType)
+			}
+		}
+		if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+			t.Errorf("expected thumbnails %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("should strip EXIF and XMP chunks from WebP files", func(t *testing.T) {
+		// Extended header with the EXIF and XMP flags and a 300x200 canvas, then a lossless bitstream header
+		vp8x := []byte{webpFlagEXIF | webpFlagXMP, 0, 0, 0, 43, 1, 0, 199, 0, 0}
+		vp8l := []byte{0x2f, 0x2b, 0x40, 0x32, 0x00, 0x00}
+		bitstream := riffChunk("VP8L", vp8l)
+		data := webpFile(riffChunk("VP8X", vp8x), bitstream, riffChunk("EXIF", exifSegment(1)[4:]),
+			riffChunk("XMP ", []byte("<x:xmpmeta>Jane Doe</x:xmpmeta>")))
+
+		processed, err := ProcessImage(data, "image/webp")
+		if err != nil {
+			t.Fatalf("Failed to process image: %v", err)
+		}
+		expected := webpFile(riffChunk("VP8X", append([]byte{0}, vp8x[1:]...)), bitstream)
+		if !bytes.Equal(processed.Content, expected) {
+			t.Errorf("expected only the EXIF and XMP chunks to be removed, got %q", processed.Content)
+		}
+		if processed.Width != 300 || processed.Height != 200 {
+			t.Errorf("expected a 300x200 image, got %dx%d", processed.Width, processed.Height)
+		}
+	})
+
+	t.Run("should refuse corrupted images", func(t *testing.T) {
+		if _, err := ProcessImage([]byte("\xff\xd8not a jpeg"), "image/jpeg"); err == nil {
+			t.Error("expected corrupted image to be refused")
+		}
+	})
+}
+
+func TestBlurhash(t *testing.T) {
+	hash := Blurhash(newTestImage(32, 32, color.RGBA{R: 0x33, G: 0x66, B: 0x99, A: 0xff}), 4, 3)
+
+	// Size flag, maximum AC value, DC value and 11 AC values
+	if len(hash) != 1+1+4+2*11 {
+		t.Fatalf("expected a hash of 28 characters, got %q", hash)
+	}
+	if hash[0] != 'L' {
+		t.Errorf("expected size flag of 4x3 components, got %q", hash[0])
+	}
+
+	// The DC component is the average color
+	var dc strings.Builder
+	encode83(&dc, 0x336699, 4)
+	if hash[2:6] != dc.String() {
+		t.Errorf("expected average color %q, got %q", dc.String(), hash[2:6])
+	}
+}
@@ -0,0 +1,207 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformedImage = errors.New("malformed image")
+
+// stripJPEG removes the metadata segments of a JPEG file without decoding it, and returns the EXIF orientation they
+// held, 1 when there was none. Only the segments needed to display the image as intended are kept: JFIF, ICC color
+// profiles and Adobe color transforms.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errMalformedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, 0, errMalformedImage
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		// The entropy-coded data follows the start of scan, copy it with the rest of the file
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), orientation, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, errMalformedImage
+		}
+		segment := data[i:end]
+
+		switch {
+		case marker == 0xE1:
+			if o, ok := exifOrientation(segment[4:]); ok {
+				orientation = o
+			}
+		case marker == 0xFE, marker >= 0xE1 && marker <= 0xEF && marker != 0xE2 && marker != 0xEE:
+			// Comments and application data such as EXIF, XMP and IPTC, which can hold locations and names
+		default:
+			out.Write(segment)
+		}
+		i = end
+	}
+}
+
+// exifOrientation reads the orientation tag from the first directory of an EXIF payload.
+func exifOrientation(payload []byte) (int, bool) {
+	tiff, ok := bytes.CutPrefix(payload, []byte("Exif\x00\x00"))
+	if !ok || len(tiff) < 8 {
+		return 0, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for entry := offset + 2; entry+12 <= len(tiff) && count > 0; entry, count = entry+12, count-1 {
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			return orientation, orientation >= 1 && orientation <= 8
+		}
+	}
+
+	return 0, false
+}
+
+// pngMetadataChunks are the ancillary PNG chunks holding text, dates and EXIF data
+var pngMetadataChunks = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "tIME": true, "eXIf": true}
+
+// stripPNG removes the metadata chunks of a PNG file without decoding it.
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errMalformedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString(signature)
+
+	for i := len(signature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, errMalformedImage
+		}
+		// Length, type, data and CRC
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, errMalformedImage
+		}
+
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	return out.Bytes(), nil
+}
+
+// webpMetadataChunks are the RIFF chunks of a WebP file holding EXIF and XMP data
+var webpMetadataChunks = map[string]bool{"EXIF": true, "XMP ": true}
+
+// VP8X flags telling that a WebP file has EXIF or XMP chunks
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+// stripWebP removes the EXIF and XMP chunks of a WebP file without decoding it, and returns the size of the image
+// read from its headers.
+func stripWebP(data []byte) ([]byte, int, int, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, 0, 0, errMalformedImage
+	}
+	end := 8 + int(binary.LittleEndian.Uint32(data[4:]))
+	if end > len(data) || end < 12 {
+		return nil, 0, 0, errMalformedImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString("RIFF\x00\x00\x00\x00WEBP")
+	var width, height int
+
+	for i := 12; i < end; {
+		if i+8 > end {
+			return nil, 0, 0, errMalformedImage
+		}
+		// FourCC, size and data, padded to an even size
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if i+8+size > end {
+			return nil, 0, 0, errMalformedImage
+		}
+		next := min(i+8+size+size&1, end)
+		kind, payload := string(data[i:i+4]), data[i+8:i+8+size]
+
+		switch kind {
+		case "VP8X":
+			if size < 10 {
+				return nil, 0, 0, errMalformedImage
+			}
+			// Flags, reserved bytes and 24-bit canvas dimensions minus one
+			width = 1 + (int(payload[4]) | int(payload[5])<<8 | int(payload[6])<<16)
+			height = 1 + (int(payload[7]) | int(payload[8])<<8 | int(payload[9])<<16)
+		case "VP8 ":
+			// Frame tag, start code and 14-bit dimensions with 2 bits of scaling
+			if size < 10 || payload[3] != 0x9d || payload[4] != 0x01 || payload[5] != 0x2a {
+				return nil, 0, 0, errMalformedImage
+			}
+			if width == 0 {
+				width = int(binary.LittleEndian.Uint16(payload[6:]) & 0x3fff)
+				height = int(binary.LittleEndian.Uint16(payload[8:]) & 0x3fff)
+			}
+		case "VP8L":
+			// Signature then 14 bits of width minus one and 14 bits of height minus one
+			if size < 5 || payload[0] != 0x2f {
+				return nil, 0, 0, errMalformedImage
+			}
+			if width == 0 {
+				bits := binary.LittleEndian.Uint32(payload[1:])
+				width, height = 1+int(bits&0x3fff), 1+int(bits>>14&0x3fff)
+			}
+		}
+
+		switch {
+		case webpMetadataChunks[kind]:
+		case kind == "VP8X":
+			// Clear the flags of the removed chunks
+			chunk := bytes.Clone(data[i:next])
+			chunk[8] &^= webpFlagXMP | webpFlagEXIF
+			out.Write(chunk)
+		default:
+			out.Write(data[i:next])
+		}
+		i = next
+	}
+
+	if width == 0 || height == 0 {
+		return nil, 0, 0, errMalformedImage
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, width, height, nil
+}
@@ -0,0 +1,148 @@
+package media
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockS3Server is a minimal S3-compatible service for tests, standing in for MinIO. It keeps the objects of a single
+// bucket in memory and refuses requests whose Signature Version 4 does not match its credentials.
+type MockS3Server struct {
+	*httptest.Server
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	mu      sync.Mutex
+	objects map[string]mockObject
+}
+
+// mockObject is an object stored by the mock service.
+type mockObject struct {
+	content     []byte
+	contentType string
+}
+
+// NewMockS3Server starts a mock service with an empty bucket. Close it when done.
+func NewMockS3Server() *MockS3Server {
+	m := &MockS3Server{
+		Bucket:    "test-bucket",
+		AccessKey: "test-access-key",
+		SecretKey: "test-secret-key",
+		objects:   map[string]mockObject{},
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+
+	return m
+}
+
+// Config returns the configuration of a store keeping files in the bucket of the mock service.
+func (m *MockS3Server) Config() S3Config {
+	return S3Config{
+		Endpoint:  m.URL,
+		Region:    "us-east-1",
+		Bucket:    m.Bucket,
+		AccessKey: m.AccessKey,
+		SecretKey: m.SecretKey,
+	}
+}
+
+// Object returns the content stored under a key, and whether there is any.
+func (m *MockS3Server) Object(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	object, ok := m.objects[key]
+	return object.content, ok
+}
+
+func (m *MockS3Server) serve(w http.ResponseWriter, r *http.Request) {
+	if !m.authorized(r) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != m.Bucket {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.objects[key] = mockObject{content: content, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		object, ok := m.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		io.Copy(w, bytes.NewReader(object.content))
+	case http.MethodDelete:
+		delete(m.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// authorized checks the Signature Version 4 of a request the way S3 does, by signing it again with the secret key.
+func (m *MockS3Server) authorized(r *http.Request) bool {
+	fields := map[string]string{}
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return false
+	}
+	for _, field := range strings.Split(auth, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[name] = value
+	}
+
+	accessKey, scope, _ := strings.Cut(fields["Credential"], "/")
+	if accessKey != m.AccessKey {
+		return false
+	}
+
+	t, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(scope, "/")
+	if len(parts) != 4 {
+		return false
+	}
+	region := parts[1]
+
+	// Only the signed headers count, the client may add others such as User-Agent on the way
+	signed := r.Clone(r.Context())
+	signed.URL.Host = r.Host
+	signed.Header = http.Header{}
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		if name != "host" {
+			signed.Header[http.CanonicalHeaderKey(name)] = r.Header.Values(name)
+		}
+	}
+
+	canonical, signedHeaders := canonicalRequest(signed, r.Header.Get("X-Amz-Content-Sha256"))
+	if signedHeaders != fields["SignedHeaders"] {
+		return false
+	}
+	expected := signV4(m.SecretKey, t, region, r.Header.Get("X-Amz-Date"), scope, canonical)
+
+	return hmac.Equal([]byte(expected), []byte(fields["Signature"]))
+}
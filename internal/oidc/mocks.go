@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MockServer is a minimal OpenID Connect provider for tests. Its authorization endpoint signs in the user described
+// by Claims without asking anything and redirects straight back with a code.
+type MockServer struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	Claims       Claims // Claims of the user signing in
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant is what the mock provider remembers about an authorization code.
+type mockGrant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      Claims
+}
+
+// NewMockServer starts a mock provider. Close it when done.
+func NewMockServer() (*MockServer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MockServer{
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		Claims:       Claims{Subject: "mock-user", Email: "mock@example.com", EmailVerified: true, PreferredUsername: "mock"},
+		key:          key,
+		codes:        map[string]mockGrant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /authorize", m.authorize)
+	mux.HandleFunc("POST /token", m.token)
+	mux.HandleFunc("GET /jwks", m.jwks)
+	m.Server = httptest.NewServer(mux)
+
+	return m, nil
+}
+
+// Config returns the configuration of a provider that signs in with the mock server.
+func (m *MockServer) Config(redirectURL string) Config {
+	return Config{
+		Name:         "mock",
+		Issuer:       m.URL,
+		ClientID:     m.ClientID,
+		ClientSecret: m.ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// SignIDToken signs an ID token with the key of the mock server.
+func (m *MockServer) SignIDToken(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock-key"
+
+	return token.SignedString(m.key)
+}
+
+func (m *MockServer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeMockJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 m.URL,
+		"authorization_endpoint": m.URL + "/authorize",
+		"token_endpoint":         m.URL + "/token",
+		"jwks_uri":               m.URL + "/jwks",
+	})
+}
+
+func (m *MockServer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != m.ClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code, err := RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m.mu.Lock()
+	m.codes[code] = mockGrant{
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		claims:      m.Claims,
+	}
+	m.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *MockServer) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != m.ClientID || secret != m.ClientSecret {
+		writeMockJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes can only be used once
+	m.mu.Lock()
+	grant, ok := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || grant.redirectURI != r.PostFormValue("redirect_uri") ||
+		grant.challenge != base64.RawURLEncoding.EncodeToString(hash[:]) {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := m.SignIDToken(jwt.MapClaims{
+		"iss":                m.URL,
+		"aud":                m.ClientID,
+		"sub":                grant.claims.Subject,
+		"email":              grant.claims.Email,
+		"email_verified":     grant.claims.EmailVerified,
+		"preferred_username": grant.claims.PreferredUsername,
+		"nonce":              grant.nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Minute * 5).Unix(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeMockJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (m *MockServer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeMockJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
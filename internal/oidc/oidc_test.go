@@ -0,0 +1,123 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	server, err := NewMockServer()
+	if err != nil {
+		t.Fatalf("Failed to start mock provider: %v", err)
+	}
+	defer server.Close()
+
+	ctx := context.Background()
+	provider := NewProvider(server.Config("http://localhost/callback"), server.Client())
+
+	// signIn follows the login URL to the mock provider and returns the code and state it redirects back with
+	signIn := func(t *testing.T, state, nonce, challenge string) (string, string) {
+		t.Helper()
+
+		authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+		if err != nil {
+			t.Fatalf("Failed to build login URL: %v", err)
+		}
+
+		client := server.Client()
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		resp, err := client.Get(authURL)
+		if err != nil {
+			t.Fatalf("Failed to sign in: %v", err)
+		}
+		resp.Body.Close()
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("Failed to parse callback URL: %v", err)
+		}
+
+		return callback.Query().Get("code"), callback.Query().Get("state")
+	}
+
+	t.Run("should exchange a code for verified claims", func(t *testing.T) {
+		verifier, challenge, err := NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, state := signIn(t, "state-1", "nonce-1", challenge)
+		if state != "state-1" {
+			t.Errorf("expected state to be passed back, got %q", state)
+		}
+
+		claims, err := provider.Exchange(ctx, code, verifier, "nonce-1")
+		if err != nil {
+			t.Fatalf("Failed to exchange code: %v", err)
+		}
+		if claims.Subject != "mock-user" || claims.Email != "mock@example.com" || !claims.EmailVerified {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("should reject a wrong PKCE verifier", func(t *testing.T) {
+		_, challenge, err := NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherVerifier, _, err := NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, _ := signIn(t, "state-2", "nonce-2", challenge)
+		if _, err := provider.Exchange(ctx, code, otherVerifier, "nonce-2"); err == nil {
+			t.Error("expected exchange with a wrong verifier to fail")
+		}
+	})
+
+	t.Run("should reject a replayed nonce", func(t *testing.T) {
+		verifier, challenge, err := NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, _ := signIn(t, "state-3", "nonce-3", challenge)
+		if _, err := provider.Exchange(ctx, code, verifier, "another-nonce"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("expected ErrInvalidIDToken, got %v", err)
+		}
+	})
+
+	t.Run("should reject ID tokens for another client", func(t *testing.T) {
+		token, err := server.SignIDToken(jwt.MapClaims{
+			"iss":   server.URL,
+			"aud":   "another-client",
+			"sub":   "mock-user",
+			"nonce": "nonce",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := provider.VerifyIDToken(ctx, token, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("expected ErrInvalidIDToken, got %v", err)
+		}
+	})
+
+	t.Run("should reject an issuer mismatch in discovery", func(t *testing.T) {
+		cfg := server.Config("http://localhost/callback")
+		cfg.Issuer = server.URL + "/"
+
+		other := NewProvider(cfg, server.Client())
+		if _, err := other.AuthCodeURL(ctx, "state", "nonce", "challenge"); err == nil {
+			t.Error("expected discovery to fail")
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey represents a personal access token a user created for an integration.
+type APIKey struct {
+	ID         int64    `json:"id"`
+	UserID     int64    `json:"user_id"` // ID of the user the key acts as
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"` // First characters of the key, to tell keys apart
+	Scopes     []string `json:"scopes"` // Scopes the key is allowed to use
+	Expiry     *string  `json:"expiry"` // Time the key expires, nil if it never does
+	LastUsedAt *string  `json:"last_used_at"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// APIKeyStore implements the Storage interface for API keys.
+type APIKeyStore struct {
+	db *sql.DB
+}
+
+// Create inserts a new API key with the hash of its secret. A zero expiration creates a key that never expires.
+func (s *APIKeyStore) Create(ctx context.Context, key *APIKey, hash string, exp time.Duration) error {
+	query := `INSERT INTO api_keys (user_id, name, prefix, key, scopes, expiry) VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, expiry, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var expiry *time.Time
+	if exp > 0 {
+		t := time.Now().Add(exp)
+		expiry = &t
+	}
+
+	err := s.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, hash, pq.Array(key.Scopes), expiry).
+		Scan(&key.ID, &key.Expiry, &key.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetByUserID retrieves the API keys of a user, newest first.
+func (s *APIKeyStore) GetByUserID(ctx context.Context, userID int64) ([]*APIKey, error) {
+	query := `SELECT id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+			  FROM api_keys WHERE user_id = $1
+			  ORDER BY created_at DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key := &APIKey{}
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes),
+			&key.Expiry, &key.LastUsedAt, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Delete removes an API key of a user.
+func (s *APIKeyStore) Delete(ctx context.Context, keyID, userID int64) error {
+	query := `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Authenticate retrieves the unexpired API key with the given hash and records that it was used.
+func (s *APIKeyStore) Authenticate(ctx context.Context, hash string) (*APIKey, error) {
+	query := `UPDATE api_keys SET last_used_at = NOW()
+			  WHERE key = $1 AND (expiry IS NULL OR expiry > NOW())
+			  RETURNING id, user_id, name, prefix, scopes, expiry, last_used_at, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key := &APIKey{}
+	err := s.db.QueryRowContext(ctx, query, hash).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix,
+		pq.Array(&key.Scopes), &key.Expiry, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
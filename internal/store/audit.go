@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Target types of audit events
+const (
+	AuditTargetRole   = "role"
+	AuditTargetUser   = "user"
+	AuditTargetPost   = "post"
+	AuditTargetAPIKey = "api_key"
+)
+
+// AuditEvent records a security-relevant action, who took it, on what and from where.
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"` // User who took the action, nil if nobody was authenticated
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	RequestID  string          `json:"request_id"` // ID of the request, to match the event with the request logs
+	IP         string          `json:"ip"`
+	Diff       json.RawMessage `json:"diff"` // Fields the action changed, with their old and new values
+	CreatedAt  string          `json:"created_at"`
+}
+
+// AuditQuery represents the filters and pagination of audit event queries.
+type AuditQuery struct {
+	Limit      int    `json:"limit" validate:"gte=1,lte=100"` // Maximum number of events to return, between 1 and 100
+	Offset     int    `json:"offset" validate:"gte=0"`        // Offset for pagination, starting from 0
+	ActorID    int64  `json:"actor_id" validate:"gte=0"`      // Optional actor to filter events, 0 for any
+	Action     string `json:"action" validate:"max=100"`      // Optional action to filter events
+	TargetType string `json:"target_type" validate:"max=50"`  // Optional target type to filter events
+	TargetID   string `json:"target_id" validate:"max=100"`   // Optional target ID to filter events
+	Since      string `json:"since"`                          // Optional timestamp to filter events since a specific date
+	Until      string `json:"until"`                          // Optional timestamp to filter events until a specific date
+}
+
+// Parse extracts the audit filters from the HTTP request and returns an AuditQuery.
+func (q AuditQuery) Parse(r *http.Request) (AuditQuery, error) {
+	qs := r.URL.Query()
+
+	// Parse limit
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	// Parse offset
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+
+		q.Offset = o
+	}
+
+	// Parse actor
+	actorID := qs.Get("actor_id")
+	if actorID != "" {
+		id, err := strconv.ParseInt(actorID, 10, 64)
+		if err != nil {
+			return q, err
+		}
+
+		q.ActorID = id
+	}
+
+	q.Action = qs.Get("action")
+	q.TargetType = qs.Get("target_type")
+	q.TargetID = qs.Get("target_id")
+
+	// Parse since timestamp
+	since := qs.Get("since")
+	if since != "" {
+		q.Since = parseTime(since)
+	}
+
+	// Parse until timestamp
+	until := qs.Get("until")
+	if until != "" {
+		q.Until = parseTime(until)
+	}
+
+	return q, nil
+}
+
+// AuditStore implements the Storage interface for the audit trail.
+type AuditStore struct {
+	db *sql.DB
+}
+
+// Create records an audit event.
+func (s *AuditStore) Create(ctx context.Context, event *AuditEvent) error {
+	query := `INSERT INTO audit_events (actor_id, action, target_type, target_id, request_id, ip, diff)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	diff := event.Diff
+	if diff == nil {
+		diff = json.RawMessage("{}")
+	}
+
+	return s.db.QueryRowContext(ctx, query, event.ActorID, event.Action, event.TargetType, event.TargetID,
+		event.RequestID, event.IP, []byte(diff)).
+		Scan(&event.ID, &event.CreatedAt)
+}
+
+// List retrieves a page of the audit events matching the filters, newest first.
+func (s *AuditStore) List(ctx context.Context, q AuditQuery) ([]*AuditEvent, error) {
+	query := `SELECT id, actor_id, action, target_type, target_id, request_id, ip, diff, created_at
+			  FROM audit_events
+			  WHERE ($1::BIGINT = 0 OR actor_id = $1::BIGINT)
+			  AND ($2 = '' OR action = $2)
+			  AND ($3 = '' OR target_type = $3)
+			  AND ($4 = '' OR target_id = $4)
+			  AND created_at >= COALESCE(NULLIF($5, '')::timestamptz, '-infinity')
+			  AND created_at <= COALESCE(NULLIF($6, '')::timestamptz, 'infinity')
+			  ORDER BY id DESC
+			  LIMIT $7 OFFSET $8`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.ActorID, q.Action, q.TargetType, q.TargetID, q.Since, q.Until,
+		q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	for rows.Next() {
+		event := &AuditEvent{}
+		var diff []byte
+		err := rows.Scan(&event.ID, &event.ActorID, &event.Action, &event.TargetType, &event.TargetID,
+			&event.RequestID, &event.IP, &diff, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Diff = diff
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrDuplicateCollection is returned when a user already has a bookmark collection with the same name.
+var ErrDuplicateCollection = errors.New("collection already exists")
+
+// BookmarkCollection represents a named collection of posts a user saved.
+type BookmarkCollection struct {
+	ID         int64  `json:"id"`
+	UserID     int64  `json:"user_id"` // ID of the user who owns the collection
+	Name       string `json:"name"`
+	PostsCount int64  `json:"posts_count"` // Number of posts saved in the collection
+	CreatedAt  string `json:"created_at"`
+}
+
+// BookmarkStore implements the Storage interface for bookmark collections and their posts.
+type BookmarkStore struct {
+	db *sql.DB
+}
+
+// CreateCollection creates an empty bookmark collection.
+func (s *BookmarkStore) CreateCollection(ctx context.Context, collection *BookmarkCollection) error {
+	query := `INSERT INTO bookmark_collections (user_id, name) VALUES ($1, $2) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(&collection.ID, &collection.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrDuplicateCollection
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetCollections retrieves the bookmark collections of a user with their number of posts, by name.
+func (s *BookmarkStore) GetCollections(ctx context.Context, userID int64) ([]*BookmarkCollection, error) {
+	query := `SELECT bc.id, bc.user_id, bc.name, COUNT(b.post_id), bc.created_at
+			  FROM bookmark_collections bc
+			  LEFT JOIN bookmarks b ON b.collection_id = bc.id
+			  WHERE bc.user_id = $1
+			  GROUP BY bc.id
+			  ORDER BY bc.name`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*BookmarkCollection{}
+	for rows.Next() {
+		collection := &BookmarkCollection{}
+		err := rows.Scan(&collection.ID, &collection.UserID, &collection.Name, &collection.PostsCount, &collection.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+// GetCollection retrieves a bookmark collection of a user. It returns ErrNotFound if the collection belongs to
+// someone else.
+func (s *BookmarkStore) GetCollection(ctx context.Context, collectionID, userID int64) (*BookmarkCollection, error) {
+	query := `SELECT bc.id, bc.user_id, bc.name, COUNT(b.post_id), bc.created_at
+			  FROM bookmark_collections bc
+			  LEFT JOIN bookmarks b ON b.collection_id = bc.id
+			  WHERE bc.id = $1 AND bc.user_id = $2
+			  GROUP BY bc.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	collection := &BookmarkCollection{}
+	err := s.db.QueryRowContext(ctx, query, collectionID, userID).
+		Scan(&collection.ID, &collection.UserID, &collection.Name, &collection.PostsCount, &collection.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// DeleteCollection deletes a bookmark collection of a user with its bookmarks.
+func (s *BookmarkStore) DeleteCollection(ctx context.Context, collectionID, userID int64) error {
+	query := `DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, collectionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Add saves a post in a collection. Saving a post twice does nothing. It returns ErrNotFound if the post does not
+// exist.
+func (s *BookmarkStore) Add(ctx context.Context, collectionID, postID int64) error {
+	query := `INSERT INTO bookmarks (collection_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, collectionID, postID); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Remove takes a post out of a collection.
+func (s *BookmarkStore) Remove(ctx context.Context, collectionID, postID int64) error {
+	query := `DELETE FROM bookmarks WHERE collection_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, collectionID, postID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetPosts retrieves a page of the posts saved in a collection with their authors, filtered like the feed and
+// sorted by when they were saved. Posts the owner of the collection can no longer see are left out.
+func (s *BookmarkStore) GetPosts(ctx context.Context, collectionID int64, fq PaginatedFeedQuery) ([]*Post, error) {
+	// Handle sort parameter safely
+	sortDir := "DESC"
+	if fq.Sort == "asc" {
+		sortDir = "ASC"
+	}
+
+	// Handle empty tags - if no tags provided, don't filter by tags
+	var tagsCondition string
+	queryArgs := []interface{}{collectionID, fq.Limit, fq.Offset, fq.Search}
+	if len(fq.Tags) > 0 {
+		tagsCondition = "AND p.tags && $5"
+		queryArgs = append(queryArgs, pq.Array(fq.Tags))
+	}
+
+	query := `
+   SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags, p.kind, p.original_id,
+    p.visibility, p.status, p.publish_at, u.username
+   FROM bookmarks b
+   JOIN bookmark_collections bc ON bc.id = b.collection_id
+   JOIN posts p ON p.id = b.post_id
+   JOIN users u ON u.id = p.user_id
+   WHERE
+    b.collection_id = $1 AND ` + visibleTo("p", "bc.user_id") + ` AND
+    ($4 = '' OR p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+    ` + tagsCondition + `
+   ORDER BY b.created_at ` + sortDir + `, p.id ` + sortDir + `
+   LIMIT $2 OFFSET $3
+ `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+	for rows.Next() {
+		post := &Post{User: &User{}}
+		err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &post.UpdatedAt,
+			&post.Version, pq.Array(&post.Tags), &post.Kind, &post.OriginalID, &post.Visibility, &post.Status, &post.PublishAt,
+			&post.User.Username)
+		if err != nil {
+			return nil, err
+		}
+		post.User.ID = post.UserID
+		post.OriginalDeleted = post.Kind == PostKindQuote && post.OriginalID == nil
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
@@ -8,7 +8,8 @@ import (
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:       &MockUserStore{},
+		Permissions: &MockPermissionStore{},
 	}
 }
 
@@ -23,3 +24,23 @@ func (m *MockUserStore) Get(ctx context.Context, userID string) (*store.User, er
 func (m *MockUserStore) Set(ctx context.Context, user *store.User) error {
 	return nil
 }
+
+func (m *MockUserStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
+
+// MockPermissionStore is a mock implementation of the PermissionStore interface for testing purposes.
+type MockPermissionStore struct {
+}
+
+func (m *MockPermissionStore) Get(ctx context.Context, userID int64) ([]string, error) {
+	return nil, nil
+}
+
+func (m *MockPermissionStore) Set(ctx context.Context, userID int64, permissions []string) error {
+	return nil
+}
+
+func (m *MockPermissionStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PermissionsExpTime defines the expiration time for permission cache entries
+const PermissionsExpTime = time.Minute
+
+// PermissionStore implements the Permissions interface for Redis operations
+type PermissionStore struct {
+	rdb *redis.Client // Redis client for database operations
+}
+
+// Get retrieves the resolved permissions of a user from the Redis cache, nil if they are not cached
+func (s *PermissionStore) Get(ctx context.Context, userID int64) ([]string, error) {
+	data, err := s.rdb.Get(ctx, permissionsKey(userID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			// If the key does not exist, return nil without an error
+			return nil, nil
+		}
+		return nil, err // Return any other error encountered
+	}
+
+	permissions := []string{}
+	if err := json.Unmarshal([]byte(data), &permissions); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Set stores the resolved permissions of a user in the Redis cache
+func (s *PermissionStore) Set(ctx context.Context, userID int64, permissions []string) error {
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEx(ctx, permissionsKey(userID), data, PermissionsExpTime).Err()
+}
+
+// Delete removes the resolved permissions of a user from the Redis cache, after their roles changed
+func (s *PermissionStore) Delete(ctx context.Context, userID int64) error {
+	return s.rdb.Del(ctx, permissionsKey(userID)).Err()
+}
+
+// permissionsKey returns the cache key of the permissions of a user
+func permissionsKey(userID int64) string {
+	return fmt.Sprintf("permissions-%v", userID)
+}
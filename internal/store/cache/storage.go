@@ -11,11 +11,18 @@ type Storage struct {
 	Users interface {
 		Get(context.Context, string) (*store.User, error)
 		Set(context.Context, *store.User) error
+		Delete(context.Context, int64) error
+	}
+	Permissions interface {
+		Get(context.Context, int64) ([]string, error)
+		Set(context.Context, int64, []string) error
+		Delete(context.Context, int64) error
 	}
 }
 
 func NewRedisStorage(rdb *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{rdb: rdb},
+		Users:       &UserStore{rdb: rdb},
+		Permissions: &PermissionStore{rdb: rdb},
 	}
 }
@@ -57,3 +57,10 @@ func (s *UserStore) Set(ctx context.Context, user *store.User) error {
 
 	return nil
 }
+
+// Delete removes a user from the Redis cache, after their roles changed
+func (s *UserStore) Delete(ctx context.Context, userID int64) error {
+	cacheKey := fmt.Sprintf("user-%v", userID)
+
+	return s.rdb.Del(ctx, cacheKey).Err()
+}
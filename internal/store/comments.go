@@ -3,8 +3,20 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
 )
 
+// ErrCommentConflict is returned when a comment was edited since the version being updated was read.
+var ErrCommentConflict = errors.New("comment was edited concurrently, reload it and try again")
+
+// commentColumns lists the columns selected for a comment left joined with its user (aliased c and u). Tombstones
+// have no user and come back with a zero user.
+const commentColumns = `c.id, c.post_id, COALESCE(c.user_id, 0), c.parent_id, c.depth, c.content, c.created_at, c.updated_at,
+			  c.version, c.deleted_at IS NOT NULL, (SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS replies_count,
+			  COALESCE(u.id, 0), COALESCE(u.username, '')`
+
 // Implementing the Storage interface for comments
 type CommentStore struct {
 	db *sql.DB
@@ -18,36 +30,182 @@ type CommentUser struct {
 
 // Comment represents a comment on a post.
 type Comment struct {
-	ID        int64       `json:"id"`
-	PostID    int64       `json:"post_id"` // ID of the post this comment belongs to
-	UserID    int64       `json:"user_id"` // ID of the user who created the comment
-	Content   string      `json:"content"` // Content of the comment
-	CreatedAt string      `json:"created_at"`
-	UpdatedAt string      `json:"updated_at"`
-	User      CommentUser `json:"user"` // User who created the comment
+	ID           int64       `json:"id"`
+	PostID       int64       `json:"post_id"`   // ID of the post this comment belongs to
+	UserID       int64       `json:"user_id"`   // ID of the user who created the comment
+	ParentID     *int64      `json:"parent_id"` // ID of the comment this is a reply to, nil for top-level comments
+	Depth        int         `json:"depth"`     // Nesting level of the comment, 0 for top-level comments
+	Content      string      `json:"content"`   // Content of the comment
+	CreatedAt    string      `json:"created_at"`
+	UpdatedAt    string      `json:"updated_at"`
+	Version      int64       `json:"version"`               // Version of the comment for optimistic concurrency control
+	Deleted      bool        `json:"deleted"`               // Whether the comment was deleted and only kept for its replies
+	User         CommentUser `json:"user"`                  // User who created the comment
+	RepliesCount int64       `json:"replies_count"`         // Number of direct replies to the comment
+	Replies      []*Comment  `json:"replies,omitempty"`     // Replies loaded along with the comment
+	NextCursor   string      `json:"next_cursor,omitempty"` // Cursor to load the replies that were not loaded
+	Mentions     []*Mention  `json:"mentions,omitempty"`    // Users mentioned in the content, when loaded
 }
 
-// Create inserts a new comment into the database.
+// Create inserts a new comment into the database. If the comment has a parent, its materialized path and depth are
+// derived from the parent so the whole thread can be read back in order. The users mentioned in the content are
+// recorded and notified in the same transaction.
 func (c *CommentStore) Create(ctx context.Context, comment *Comment) error {
-	query := `INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) 
-			  RETURNING id, created_at, updated_at`
+	query := `WITH new_comment AS (SELECT nextval(pg_get_serial_sequence('comments', 'id')) AS id)
+			  INSERT INTO comments (id, post_id, user_id, content, parent_id, path, depth)
+			  SELECT n.id, $1, $2, $3, $4, COALESCE(p.path, '{}') || n.id, COALESCE(p.depth + 1, 0)
+			  FROM new_comment n LEFT JOIN comments p ON p.id = $4
+			  RETURNING id, depth, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(c.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content, comment.ParentID).
+			Scan(&comment.ID, &comment.Depth, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version)
+		if err != nil {
+			return err
+		}
+
+		comment.Mentions, err = saveMentions(ctx, tx, comment.PostID, &comment.ID, comment.Content)
+		return err
+	})
+}
+
+// GetByID retrieves a comment by its ID, along with the user who created it.
+func (c *CommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM
+			  comments c LEFT JOIN users u ON u.id = c.user_id
+              WHERE c.id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := c.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).
-		Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
+	comment := &Comment{}
+	err := scanComment(c.db.QueryRowContext(ctx, query, commentID), comment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// Update modifies the content of an existing comment, using the version for optimistic concurrency control, and
+// records the users mentioned in the new content. It returns ErrNotFound if the comment is gone or was deleted, and
+// ErrCommentConflict if it was edited since the version was read.
+func (c *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `UPDATE comments SET content = $1, version = version + 1, updated_at = NOW()
+			  WHERE id = $2 AND version = $3 AND deleted_at IS NULL RETURNING post_id, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(c.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, comment.Content, comment.ID, comment.Version).
+			Scan(&comment.PostID, &comment.UpdatedAt, &comment.Version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.updateError(ctx, tx, comment.ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		comment.Mentions, err = saveMentions(ctx, tx, comment.PostID, &comment.ID, comment.Content)
+		return err
+	})
+}
+
+// updateError tells why a comment could not be updated: it is gone, or it was edited since the version was read.
+func (c *CommentStore) updateError(ctx context.Context, tx *sql.Tx, commentID int64) error {
+	var deleted bool
+	err := tx.QueryRowContext(ctx, `SELECT deleted_at IS NOT NULL FROM comments WHERE id = $1`, commentID).Scan(&deleted)
+	if errors.Is(err, sql.ErrNoRows) || deleted {
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return ErrCommentConflict
+}
+
+// Delete removes a comment by its ID from the database. A comment with replies is turned into a tombstone instead,
+// without content, author or mentions, so the replies of other users stay in the thread. Removing the last reply of
+// a tombstone removes the tombstone too, up the thread.
+func (c *CommentStore) Delete(ctx context.Context, commentID int64) error {
+	tombstoneQuery := `UPDATE comments SET content = '', user_id = NULL, deleted_at = NOW(), version = version + 1
+			  WHERE id = $1 AND deleted_at IS NULL AND EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = $1)`
+
+	deleteQuery := `DELETE FROM comments WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = $1)
+			  RETURNING parent_id`
+
+	pruneQuery := `DELETE FROM comments
+			  WHERE id = $1 AND deleted_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = $1)
+			  RETURNING parent_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(c.db, ctx, func(tx *sql.Tx) error {
+		// lock the comment so a reply cannot be added while deciding how to delete it
+		var deleted bool
+		err := tx.QueryRowContext(ctx, `SELECT deleted_at IS NOT NULL FROM comments WHERE id = $1 FOR UPDATE`, commentID).
+			Scan(&deleted)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if deleted {
+			return ErrNotFound
+		}
+
+		result, err := tx.ExecContext(ctx, tombstoneQuery, commentID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected > 0 {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM mentions WHERE comment_id = $1`, commentID); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM notifications WHERE comment_id = $1`, commentID)
+			return err
+		}
+
+		var parentID *int64
+		if err := tx.QueryRowContext(ctx, deleteQuery, commentID).Scan(&parentID); err != nil {
+			return err
+		}
+
+		// remove the tombstones left without replies
+		for parentID != nil {
+			err := tx.QueryRowContext(ctx, pruneQuery, *parentID).Scan(&parentID)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 // GetByPostID retrieves all comments for a specific post by its ID, along with the user information for each comment.
 func (c *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]*Comment, error) {
-	query := `SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, c.updated_at, u.id, u.username FROM 
-			  comments c JOIN users u ON u.id = c.user_id 
+	query := `SELECT ` + commentColumns + ` FROM
+			  comments c LEFT JOIN users u ON u.id = c.user_id
               WHERE c.post_id = $1
               ORDER BY c.created_at DESC`
 
@@ -60,12 +218,190 @@ func (c *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]*Commen
 	}
 	defer rows.Close()
 
+	return scanComments(rows)
+}
+
+// ListByPostID retrieves a page of comments for a specific post, honoring the limit, offset, sort and search
+// parameters of the query.
+func (c *CommentStore) ListByPostID(ctx context.Context, postID int64, fq PaginatedFeedQuery) ([]*Comment, error) {
+	// Handle sort parameter safely
+	sortDir := "DESC"
+	if fq.Sort == "asc" {
+		sortDir = "ASC"
+	}
+
+	query := `SELECT ` + commentColumns + ` FROM
+			  comments c LEFT JOIN users u ON u.id = c.user_id
+              WHERE c.post_id = $1 AND ($4 = '' OR c.content ILIKE '%' || $4 || '%')
+              ORDER BY c.created_at ` + sortDir + `, c.id ` + sortDir + `
+              LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query, postID, fq.Limit, fq.Offset, fq.Search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+// GetThreads retrieves a page of top-level comments for a post, newest first, each with its replies nested down to
+// the maximum depth of the query. It also returns the cursor for the next page of threads, empty on the last page.
+func (c *CommentStore) GetThreads(ctx context.Context, postID int64, q CommentThreadQuery) ([]*Comment, string, error) {
+	query := `SELECT id FROM comments
+			  WHERE post_id = $1 AND parent_id IS NULL AND ($2 = 0 OR id < $2)
+			  ORDER BY id DESC
+			  LIMIT $3`
+
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return c.getTree(ctx, query, q, postID, after)
+}
+
+// GetReplies retrieves a page of direct replies to a comment, oldest first, each with its own replies nested down to
+// the maximum depth of the query. It also returns the cursor for the next page of replies, empty on the last page.
+func (c *CommentStore) GetReplies(ctx context.Context, parentID int64, q CommentThreadQuery) ([]*Comment, string, error) {
+	query := `SELECT id FROM comments
+			  WHERE parent_id = $1 AND id > $2
+			  ORDER BY id ASC
+			  LIMIT $3`
+
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return c.getTree(ctx, query, q, parentID, after)
+}
+
+// getTree selects a page of comment IDs with the given query and loads them along with their replies as a tree.
+// The query receives the owner ID (post or parent comment), the cursor position and the page size, in that order.
+func (c *CommentStore) getTree(ctx context.Context, query string, q CommentThreadQuery, ownerID, after int64) ([]*Comment, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// fetch one more row than requested to know if there is a next page
+	rows, err := c.db.QueryContext(ctx, query, ownerID, after, q.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(ids) > q.Limit {
+		ids = ids[:q.Limit]
+		nextCursor = EncodeCursor(ids[len(ids)-1])
+	}
+
+	if len(ids) == 0 {
+		return []*Comment{}, "", nil
+	}
+
+	// Walk down from the selected comments, keeping at most RepliesLimit replies per comment and stopping at
+	// MaxDepth levels below them. The materialized path gives the rows back in thread order.
+	treeQuery := `WITH RECURSIVE thread AS (
+				SELECT id, 0 AS level FROM comments WHERE id = ANY($1)
+				UNION ALL
+				SELECT r.id, t.level + 1
+				FROM thread t
+				JOIN LATERAL (
+					SELECT ch.id FROM comments ch WHERE ch.parent_id = t.id ORDER BY ch.id LIMIT $2
+				) r ON TRUE
+				WHERE t.level < $3
+			  )
+			  SELECT ` + commentColumns + `
+			  FROM thread t
+			  JOIN comments c ON c.id = t.id
+			  LEFT JOIN users u ON u.id = c.user_id
+			  ORDER BY c.path`
+
+	treeRows, err := c.db.QueryContext(ctx, treeQuery, pq.Array(ids), q.RepliesLimit, q.MaxDepth)
+	if err != nil {
+		return nil, "", err
+	}
+	defer treeRows.Close()
+
+	comments, err := scanComments(treeRows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buildCommentTree(ids, comments), nextCursor, nil
+}
+
+// buildCommentTree nests the comments, given in thread order, under their parents and returns the comments with the
+// given IDs in that order. Comments with replies that were not loaded get a cursor to load them.
+func buildCommentTree(ids []int64, comments []*Comment) []*Comment {
+	byID := make(map[int64]*Comment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	heads := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		heads[id] = true
+	}
+
+	for _, comment := range comments {
+		if heads[comment.ID] || comment.ParentID == nil {
+			continue
+		}
+		if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+
+	for _, comment := range comments {
+		if comment.RepliesCount > int64(len(comment.Replies)) {
+			var last int64
+			if len(comment.Replies) > 0 {
+				last = comment.Replies[len(comment.Replies)-1].ID
+			}
+			comment.NextCursor = EncodeCursor(last)
+		}
+	}
+
+	tree := make([]*Comment, 0, len(ids))
+	for _, id := range ids {
+		if comment, ok := byID[id]; ok {
+			tree = append(tree, comment)
+		}
+	}
+
+	return tree
+}
+
+// scanComment scans a single comment row joined with its user, as selected by commentColumns.
+func scanComment(row interface{ Scan(...any) error }, comment *Comment) error {
+	return row.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.ParentID, &comment.Depth, &comment.Content,
+		&comment.CreatedAt, &comment.UpdatedAt, &comment.Version, &comment.Deleted, &comment.RepliesCount, &comment.User.ID, &comment.User.Username)
+}
+
+// scanComments scans comment rows joined with their user into a slice of comments.
+func scanComments(rows *sql.Rows) ([]*Comment, error) {
 	var comments []*Comment
 	for rows.Next() {
 		comment := &Comment{}
 		comment.User = CommentUser{} // Initialize User to avoid nil pointer dereference
-		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content,
-			&comment.CreatedAt, &comment.UpdatedAt, &comment.User.ID, &comment.User.Username); err != nil {
+		if err := scanComment(rows, comment); err != nil {
 			return nil, err
 		}
 		comments = append(comments, comment)
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestUpdateComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     *sqlmock.Rows // state of the comment when the update matched no row, nil if it is gone
+		expected error
+	}{
+		{"should report a comment edited meanwhile as a conflict", sqlmock.NewRows([]string{"deleted"}).AddRow(false), ErrCommentConflict},
+		{"should report a deleted comment as not found", sqlmock.NewRows([]string{"deleted"}).AddRow(true), ErrNotFound},
+		{"should report a removed comment as not found", nil, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`UPDATE comments SET content`).WithArgs("edited", 5, 1).WillReturnError(sql.ErrNoRows)
+			query := mock.ExpectQuery(`SELECT deleted_at IS NOT NULL FROM comments`).WithArgs(5)
+			if tt.rows != nil {
+				query.WillReturnRows(tt.rows)
+			} else {
+				query.WillReturnError(sql.ErrNoRows)
+			}
+			mock.ExpectRollback()
+
+			store := &CommentStore{db}
+			err = store.Update(context.Background(), &Comment{ID: 5, Content: "edited", Version: 1})
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("Expected error %v, got %v", tt.expected, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
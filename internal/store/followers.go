@@ -45,3 +45,14 @@ func (f *FollowerStore) Unfollow(ctx context.Context, toUnfollowID int64, userID
 	_, err := f.db.ExecContext(ctx, query, userID, toUnfollowID)
 	return err
 }
+
+// IsFollowing reports whether a user follows another user.
+func (f *FollowerStore) IsFollowing(ctx context.Context, followedID int64, userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var following bool
+	err := f.db.QueryRowContext(ctx, query, userID, followedID).Scan(&following)
+	return following, err
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrIdentityLinked is returned when linking an identity that is already linked to another user.
+var ErrIdentityLinked = errors.New("identity is already linked to another user")
+
+// Identity links a user to their account at an external identity provider.
+type Identity struct {
+	Provider  string `json:"provider"`
+	Subject   string `json:"subject"` // ID of the user at the provider
+	UserID    int64  `json:"user_id"`
+	Email     string `json:"email"` // Email the provider vouched for when the identity was linked
+	CreatedAt string `json:"created_at"`
+}
+
+// OIDCLoginState holds what a login at an identity provider needs to be completed on callback.
+type OIDCLoginState struct {
+	Provider     string
+	Nonce        string // Nonce the ID token must carry
+	CodeVerifier string // PKCE verifier of the code challenge sent to the provider
+}
+
+// IdentityStore implements the Storage interface for external identities.
+type IdentityStore struct {
+	db *sql.DB
+}
+
+// GetByProviderSubject retrieves the identity of a user at a provider.
+func (s *IdentityStore) GetByProviderSubject(ctx context.Context, provider, subject string) (*Identity, error) {
+	query := `SELECT provider, subject, user_id, email, created_at FROM user_identities
+			  WHERE provider = $1 AND subject = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	identity := &Identity{}
+	err := s.db.QueryRowContext(ctx, query, provider, subject).
+		Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// Link links an identity to an existing user.
+func (s *IdentityStore) Link(ctx context.Context, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return createIdentity(ctx, tx, identity)
+	})
+}
+
+// CreateLoginState stores a login in progress under the hash of its state parameter. Expired logins are purged
+// along the way.
+func (s *IdentityStore) CreateLoginState(ctx context.Context, state *OIDCLoginState, hash string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expiry <= NOW()`); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO oidc_login_states (state, provider, nonce, code_verifier, expiry) VALUES ($1, $2, $3, $4, $5)`
+		_, err := tx.ExecContext(ctx, query, hash, state.Provider, state.Nonce, state.CodeVerifier, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ConsumeLoginState deletes the unexpired login with the given state hash and returns it, so that a callback can
+// only be completed once. It returns ErrNotFound if there is no such login.
+func (s *IdentityStore) ConsumeLoginState(ctx context.Context, hash string) (*OIDCLoginState, error) {
+	query := `DELETE FROM oidc_login_states WHERE state = $1 AND expiry > $2
+			  RETURNING provider, nonce, code_verifier`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	state := &OIDCLoginState{}
+	err := s.db.QueryRowContext(ctx, query, hash, time.Now()).Scan(&state.Provider, &state.Nonce, &state.CodeVerifier)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// createIdentity inserts an identity. Linking an identity that is already linked to the same user does nothing.
+func createIdentity(ctx context.Context, tx *sql.Tx, identity *Identity) error {
+	query := `INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (provider, subject) DO UPDATE SET email = EXCLUDED.email
+			  WHERE user_identities.user_id = EXCLUDED.user_id
+			  RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(ctx, query, identity.Provider, identity.Subject, identity.UserID, identity.Email).
+		Scan(&identity.CreatedAt)
+	if err != nil {
+		// The identity is linked to another user
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrIdentityLinked
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Kinds of keys failed logins are counted by
+const (
+	LoginFailureAccount = "account" // Failures for an email address
+	LoginFailureIP      = "ip"      // Failures from a client IP address
+)
+
+// LoginFailureStore implements the Storage interface for failed login attempts.
+type LoginFailureStore struct {
+	db *sql.DB
+}
+
+// GetLockedUntil returns the time a key is locked until, or nil if it is not locked.
+func (s *LoginFailureStore) GetLockedUntil(ctx context.Context, kind, key string) (*time.Time, error) {
+	query := `SELECT locked_until FROM login_failures WHERE kind = $1 AND key = $2 AND locked_until > NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var lockedUntil time.Time
+	err := s.db.QueryRowContext(ctx, query, kind, key).Scan(&lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &lockedUntil, nil
+}
+
+// RecordFailure counts a failed login for a key and returns the number of consecutive failures. The count starts
+// over when the previous failure is older than the window.
+func (s *LoginFailureStore) RecordFailure(ctx context.Context, kind, key string, window time.Duration) (int, error) {
+	query := `INSERT INTO login_failures (kind, key, failures) VALUES ($1, $2, 1)
+			  ON CONFLICT (kind, key) DO UPDATE SET
+			  failures = CASE WHEN login_failures.last_failure_at < NOW() - $3 * INTERVAL '1 second' THEN 1
+			                  ELSE login_failures.failures + 1 END,
+			  last_failure_at = NOW()
+			  RETURNING failures`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var failures int
+	if err := s.db.QueryRowContext(ctx, query, kind, key, window.Seconds()).Scan(&failures); err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+// Lock locks a key for the given duration.
+func (s *LoginFailureStore) Lock(ctx context.Context, kind, key string, d time.Duration) error {
+	query := `UPDATE login_failures SET locked_until = NOW() + $3 * INTERVAL '1 second' WHERE kind = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, kind, key, d.Seconds())
+	return err
+}
+
+// Reset clears the failed logins and any lock of a key.
+func (s *LoginFailureStore) Reset(ctx context.Context, kind, key string) error {
+	query := `DELETE FROM login_failures WHERE kind = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, kind, key)
+	return err
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginLink represents a single-use passwordless sign-in link emailed to a user.
+type LoginLink struct {
+	UserID    int64
+	IP        string // Address the link was requested from
+	UserAgent string // User agent the link was requested with
+}
+
+// LoginLinkStore implements the Storage interface for passwordless sign-in links.
+type LoginLinkStore struct {
+	db *sql.DB
+}
+
+// Create stores a sign-in link with the hash of its token, replacing any link issued to the user before.
+func (s *LoginLinkStore) Create(ctx context.Context, link *LoginLink, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM login_links WHERE user_id = $1`, link.UserID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO login_links (token, user_id, expiry, ip, user_agent) VALUES ($1, $2, $3, $4, $5)`
+		_, err := tx.ExecContext(ctx, query, token, link.UserID, time.Now().Add(exp), link.IP, link.UserAgent)
+		return err
+	})
+}
+
+// Consume deletes the unexpired sign-in link with the given token hash and returns it, so that it can only be used
+// once. It returns ErrNotFound if there is no such link.
+func (s *LoginLinkStore) Consume(ctx context.Context, token string) (*LoginLink, error) {
+	query := `DELETE FROM login_links WHERE token = $1 AND expiry > $2 RETURNING user_id, ip, user_agent`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	link := &LoginLink{}
+	err := s.db.QueryRowContext(ctx, query, token, time.Now()).Scan(&link.UserID, &link.IP, &link.UserAgent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return link, nil
+}
@@ -0,0 +1,364 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Processing statuses of media
+const (
+	MediaStatusPending = "pending" // Waiting for the image to be processed, not served until then
+	MediaStatusReady   = "ready"   // Served, with its variants if it is an image
+	MediaStatusFailed  = "failed"  // The image could not be processed and is never served
+)
+
+// ErrMediaUnavailable is returned when attaching media that does not exist, belongs to another user or is already
+// attached to a post.
+var ErrMediaUnavailable = errors.New("media not found or already attached")
+
+// Media represents an uploaded file, attached to a post or waiting to be.
+type Media struct {
+	ID          int64           `json:"id"`
+	UserID      int64           `json:"user_id"`           // ID of the user who uploaded the file
+	PostID      *int64          `json:"post_id,omitempty"` // ID of the post the file is attached to
+	StorageKey  string          `json:"-"`                 // Key of the content in the blob store
+	ContentType string          `json:"content_type"`
+	Size        int64           `json:"size"` // Size of the content in bytes
+	CreatedAt   string          `json:"created_at"`
+	Status      string          `json:"status"`             // Processing status, one of the MediaStatus constants
+	Width       *int            `json:"width,omitempty"`    // Width of processed images
+	Height      *int            `json:"height,omitempty"`   // Height of processed images
+	Blurhash    *string         `json:"blurhash,omitempty"` // Placeholder of processed images to show while they load
+	Attempts    int             `json:"-"`                  // Number of times processing was started
+	URL         string          `json:"url,omitempty"`      // Signed URL to download the content, until it expires
+	Variants    []*MediaVariant `json:"variants,omitempty"` // Resized copies of processed images, from the smallest
+}
+
+// MediaVariant represents a resized copy of an uploaded image.
+type MediaVariant struct {
+	Name        string `json:"name"`
+	StorageKey  string `json:"-"` // Key of the content in the blob store
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`          // Size of the content in bytes
+	URL         string `json:"url,omitempty"` // Signed URL to download the content, until it expires
+}
+
+// mediaColumns are the columns scanned by scanMedia
+const mediaColumns = `id, user_id, post_id, storage_key, content_type, size, created_at, status, width, height, blurhash,
+			  attempts`
+
+// scanMedia scans a row of mediaColumns.
+func scanMedia(row interface{ Scan(...any) error }) (*Media, error) {
+	m := &Media{}
+	err := row.Scan(&m.ID, &m.UserID, &m.PostID, &m.StorageKey, &m.ContentType, &m.Size, &m.CreatedAt, &m.Status,
+		&m.Width, &m.Height, &m.Blurhash, &m.Attempts)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// MediaStore implements the Storage interface for uploaded files.
+type MediaStore struct {
+	db *sql.DB
+}
+
+// Create records an uploaded file, not attached to any post yet. Files without a status are ready to be served.
+func (s *MediaStore) Create(ctx context.Context, media *Media) error {
+	query := `INSERT INTO media (user_id, storage_key, content_type, size, status) VALUES ($1, $2, $3, $4, $5)
+			  RETURNING id, created_at`
+
+	if media.Status == "" {
+		media.Status = MediaStatusReady
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, media.UserID, media.StorageKey, media.ContentType, media.Size, media.Status).
+		Scan(&media.ID, &media.CreatedAt)
+}
+
+// GetByID retrieves an uploaded file by its ID, with its variants.
+func (s *MediaStore) GetByID(ctx context.Context, mediaID int64) (*Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	media, err := scanMedia(s.db.QueryRowContext(ctx, query, mediaID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if err := loadVariants(ctx, s.db, []*Media{media}); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// GetByPostIDs retrieves the files attached to posts with their variants, by post ID and in the order they were
+// attached in.
+func (s *MediaStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]*Media, error) {
+	query := `SELECT ` + mediaColumns + `
+			  FROM media WHERE post_id = ANY($1)
+			  ORDER BY position`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	media, err := s.query(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	byPost := map[int64][]*Media{}
+	for _, m := range media {
+		byPost[*m.PostID] = append(byPost[*m.PostID], m)
+	}
+
+	return byPost, nil
+}
+
+// GetUnattached retrieves up to limit files with their variants that have not been attached to any post for longer
+// than the given age, either because they were never attached or because their post was deleted.
+func (s *MediaStore) GetUnattached(ctx context.Context, age time.Duration, limit int) ([]*Media, error) {
+	query := `SELECT ` + mediaColumns + `
+			  FROM media WHERE post_id IS NULL AND created_at < NOW() - $1 * INTERVAL '1 second'
+			  ORDER BY created_at
+			  LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.query(ctx, query, age.Seconds(), limit)
+}
+
+// Delete removes the record of an unattached file. It returns ErrNotFound if the file was attached in the meantime.
+func (s *MediaStore) Delete(ctx context.Context, mediaID int64) error {
+	query := `DELETE FROM media WHERE id = $1 AND post_id IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, mediaID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ClaimPending claims up to limit files waiting to be processed and counts an attempt for each. Files claimed for
+// longer than the lease, by a worker that stopped before finishing, can be claimed again. Workers running at the same
+// time claim different files.
+func (s *MediaStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*Media, error) {
+	query := `UPDATE media SET claimed_at = NOW(), attempts = attempts + 1
+			  WHERE id IN (
+				  SELECT id FROM media
+				  WHERE status = 'pending' AND (claimed_at IS NULL OR claimed_at < NOW() - $2 * INTERVAL '1 second')
+				  ORDER BY id
+				  LIMIT $1
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING ` + mediaColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []*Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+
+	return media, rows.Err()
+}
+
+// SaveProcessed records the size, dimensions, blurhash and variants of a processed file and marks it ready.
+func (s *MediaStore) SaveProcessed(ctx context.Context, media *Media) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE media SET status = 'ready', size = $2, width = $3, height = $4, blurhash = $5, claimed_at = NULL
+				  WHERE id = $1`
+
+		res, err := tx.ExecContext(ctx, query, media.ID, media.Size, media.Width, media.Height, media.Blurhash)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		// Replace the variants of an earlier attempt that stopped midway
+		if _, err := tx.ExecContext(ctx, `DELETE FROM media_variants WHERE media_id = $1`, media.ID); err != nil {
+			return err
+		}
+		for _, v := range media.Variants {
+			query := `INSERT INTO media_variants (media_id, name, storage_key, content_type, width, height, size)
+					  VALUES ($1, $2, $3, $4, $5, $6, $7)`
+			if _, err := tx.ExecContext(ctx, query, media.ID, v.Name, v.StorageKey, v.ContentType, v.Width, v.Height, v.Size); err != nil {
+				return err
+			}
+		}
+
+		media.Status = MediaStatusReady
+		return nil
+	})
+}
+
+// MarkFailed marks a file that cannot be processed, so that it is never served.
+func (s *MediaStore) MarkFailed(ctx context.Context, mediaID int64) error {
+	query := `UPDATE media SET status = 'failed', claimed_at = NULL WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, mediaID)
+	return err
+}
+
+// query retrieves the files selected by a query of mediaColumns, with their variants.
+func (s *MediaStore) query(ctx context.Context, query string, args ...any) ([]*Media, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []*Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadVariants(ctx, s.db, media); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// loadVariants attaches their variants to files, from the smallest.
+func loadVariants(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}, media []*Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Media, len(media))
+	ids := make([]int64, len(media))
+	for i, m := range media {
+		byID[m.ID] = m
+		ids[i] = m.ID
+	}
+
+	query := `SELECT media_id, name, storage_key, content_type, width, height, size
+			  FROM media_variants WHERE media_id = ANY($1)
+			  ORDER BY width`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mediaID int64
+		v := &MediaVariant{}
+		if err := rows.Scan(&mediaID, &v.Name, &v.StorageKey, &v.ContentType, &v.Width, &v.Height, &v.Size); err != nil {
+			return err
+		}
+		byID[mediaID].Variants = append(byID[mediaID].Variants, v)
+	}
+
+	return rows.Err()
+}
+
+// attachMedia attaches the files listed in post.Media to the post within a transaction and loads them. It returns
+// ErrMediaUnavailable unless every file is an unattached upload of the author of the post.
+func attachMedia(ctx context.Context, tx *sql.Tx, post *Post) error {
+	if len(post.Media) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(post.Media))
+	for i, m := range post.Media {
+		ids[i] = m.ID
+	}
+
+	query := `UPDATE media SET post_id = $1, position = array_position($2, id)
+			  WHERE id = ANY($2) AND user_id = $3 AND post_id IS NULL
+			  RETURNING ` + mediaColumns
+
+	rows, err := tx.QueryContext(ctx, query, post.ID, pq.Array(ids), post.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	attached := map[int64]*Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return err
+		}
+		attached[m.ID] = m
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// Keep the order the files were listed in
+	for i, id := range ids {
+		m, ok := attached[id]
+		if !ok {
+			return ErrMediaUnavailable
+		}
+		post.Media[i] = m
+	}
+
+	return loadVariants(ctx, tx, post.Media)
+}
@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// mentionPattern matches an @ sign followed by a username, unless it follows a character of a word or another @ sign
+// like in email addresses. Usernames may contain dots and hyphens between their other characters, so that a mention
+// at the end of a sentence leaves out the punctuation.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\pL\pN_@])@([\pL\pN_]+(?:[.\-][\pL\pN_]+)*)`)
+
+// maxMentionedUsers is the number of distinct users a post or comment can mention, so that it cannot notify crowds.
+// Later mentions of other users are left as plain text.
+const maxMentionedUsers = 20
+
+// Mention represents a user mentioned in the content of a post or comment.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Start    int    `json:"start"` // Offset of the @ sign in the content, in characters
+	End      int    `json:"end"`   // Offset right after the username, in characters
+}
+
+// MentionedIn represents a post or comment mentioning a user.
+type MentionedIn struct {
+	PostID    int64       `json:"post_id"`
+	CommentID *int64      `json:"comment_id,omitempty"` // ID of the comment, for mentions in a comment
+	User      CommentUser `json:"user"`                 // Author of the post or comment
+	Content   string      `json:"content"`
+	Mentions  []*Mention  `json:"mentions"` // Every mention in the content
+	CreatedAt string      `json:"created_at"`
+}
+
+// ParseMentions returns the mentions of usernames in content, in order, without resolving them to users. Offsets are
+// counted in characters rather than bytes.
+func ParseMentions(content string) []*Mention {
+	var mentions []*Mention
+
+	// Count characters from the previous mention on rather than from the start every time
+	offset, chars := 0, 0
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		at, end := loc[2]-1, loc[3]
+		chars += utf8.RuneCountInString(content[offset:at])
+		start := chars
+		chars += utf8.RuneCountInString(content[at:end])
+		offset = end
+
+		mentions = append(mentions, &Mention{Username: content[loc[2]:loc[3]], Start: start, End: chars})
+	}
+
+	return mentions
+}
+
+// MentionStore implements the Storage interface for mentions.
+type MentionStore struct {
+	db *sql.DB
+}
+
+// GetByPostIDs retrieves the mentions in the content of posts by post ID, in order.
+func (s *MentionStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]*Mention, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return getMentions(ctx, s.db, `m.post_id = ANY($1) AND m.comment_id IS NULL`, "m.post_id", pq.Array(postIDs))
+}
+
+// GetByCommentIDs retrieves the mentions in the content of comments by comment ID, in order.
+func (s *MentionStore) GetByCommentIDs(ctx context.Context, commentIDs []int64) (map[int64][]*Mention, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return getMentions(ctx, s.db, `m.comment_id = ANY($1)`, "m.comment_id", pq.Array(commentIDs))
+}
+
+// ListByUserID retrieves a page of the posts and comments mentioning a user with their authors and mentions, newest
+// first. Those in posts the user can no longer see are left out.
+func (s *MentionStore) ListByUserID(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*MentionedIn, error) {
+	sortDir := "DESC"
+	if fq.Sort == "asc" {
+		sortDir = "ASC"
+	}
+
+	query := `SELECT m.post_id, m.comment_id, u.id, u.username, COALESCE(c.content, p.content),
+			  COALESCE(c.created_at, p.created_at) AS created_at
+			  FROM (SELECT DISTINCT post_id, comment_id FROM mentions WHERE user_id = $1) m
+			  JOIN posts p ON p.id = m.post_id
+			  LEFT JOIN comments c ON c.id = m.comment_id
+			  JOIN users u ON u.id = COALESCE(c.user_id, p.user_id)
+			  WHERE ` + visibleTo("p", "$1") + `
+			  ORDER BY created_at ` + sortDir + `, m.post_id ` + sortDir + `, m.comment_id ` + sortDir + ` NULLS FIRST
+			  LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var postIDs, commentIDs []int64
+	mentionedIn := []*MentionedIn{}
+	for rows.Next() {
+		m := &MentionedIn{}
+		err := rows.Scan(&m.PostID, &m.CommentID, &m.User.ID, &m.User.Username, &m.Content, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if m.CommentID != nil {
+			commentIDs = append(commentIDs, *m.CommentID)
+		} else {
+			postIDs = append(postIDs, m.PostID)
+		}
+		mentionedIn = append(mentionedIn, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	byPost, err := getMentions(ctx, s.db, `m.post_id = ANY($1) AND m.comment_id IS NULL`, "m.post_id", pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	byComment, err := getMentions(ctx, s.db, `m.comment_id = ANY($1)`, "m.comment_id", pq.Array(commentIDs))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mentionedIn {
+		if m.CommentID != nil {
+			m.Mentions = byComment[*m.CommentID]
+		} else {
+			m.Mentions = byPost[m.PostID]
+		}
+	}
+
+	return mentionedIn, nil
+}
+
+// getMentions retrieves the mentions matching a condition on the mentions table (aliased m), grouped by the value of
+// the given column.
+func getMentions(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}, condition, groupBy string, args ...any) (map[int64][]*Mention, error) {
+	query := `SELECT ` + groupBy + `, m.user_id, u.username, m.start_offset, m.end_offset
+			  FROM mentions m JOIN users u ON u.id = m.user_id
+			  WHERE ` + condition + `
+			  ORDER BY m.start_offset`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := map[int64][]*Mention{}
+	for rows.Next() {
+		var id int64
+		m := &Mention{}
+		if err := rows.Scan(&id, &m.UserID, &m.Username, &m.Start, &m.End); err != nil {
+			return nil, err
+		}
+		mentions[id] = append(mentions[id], m)
+	}
+
+	return mentions, rows.Err()
+}
+
+// saveMentions replaces the mentions of a post, or of one of its comments, with those in its content within a
+// transaction, and notifies the users it newly mentions. Mentions of usernames that do not belong to an active user
+// are left as plain text. It returns the mentions that were resolved to users.
+func saveMentions(ctx context.Context, tx *sql.Tx, postID int64, commentID *int64, content string) ([]*Mention, error) {
+	query := `DELETE FROM mentions WHERE post_id = $1 AND comment_id IS NOT DISTINCT FROM $2`
+	if _, err := tx.ExecContext(ctx, query, postID, commentID); err != nil {
+		return nil, err
+	}
+
+	parsed := ParseMentions(content)
+	if len(parsed) == 0 {
+		return []*Mention{}, nil
+	}
+
+	var usernames []string
+	seen := map[string]bool{}
+	for _, m := range parsed {
+		if !seen[m.Username] && len(usernames) < maxMentionedUsers {
+			usernames = append(usernames, m.Username)
+		}
+		seen[m.Username] = true
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, username FROM users WHERE username = ANY($1) AND is_active = true`,
+		pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		userIDs[username] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	mentions := []*Mention{}
+	var ids, starts, ends []int64
+	for _, m := range parsed {
+		id, ok := userIDs[m.Username]
+		if !ok {
+			continue
+		}
+		m.UserID = id
+		mentions = append(mentions, m)
+		ids = append(ids, m.UserID)
+		starts = append(starts, int64(m.Start))
+		ends = append(ends, int64(m.End))
+	}
+	if len(mentions) == 0 {
+		return mentions, nil
+	}
+
+	query = `INSERT INTO mentions (post_id, comment_id, user_id, start_offset, end_offset)
+			 SELECT $1::BIGINT, $2::BIGINT, t.user_id, t.start_offset, t.end_offset
+			 FROM unnest($3::BIGINT[], $4::INT[], $5::INT[]) AS t (user_id, start_offset, end_offset)`
+	_, err = tx.ExecContext(ctx, query, postID, commentID, pq.Array(ids), pq.Array(starts), pq.Array(ends))
+	if err != nil {
+		return nil, err
+	}
+
+	return mentions, notifyMentions(ctx, tx, []int64{postID}, commentID)
+}
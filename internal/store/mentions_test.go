@@ -0,0 +1,35 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string // username@start-end for each mention
+	}{
+		{"should find mentions anywhere in the content", "@alice and @bob_2", []string{"alice@0-6", "bob_2@11-17"}},
+		{"should leave out trailing punctuation", "thanks @alice.", []string{"alice@7-13"}},
+		{"should keep dots and hyphens inside usernames", "cc @jane.doe-1!", []string{"jane.doe-1@3-14"}},
+		{"should ignore email addresses", "mail bob@example.com", nil},
+		{"should ignore repeated @ signs", "@@alice", nil},
+		{"should count offsets in characters", "héllo 👋 @zoë", []string{"zoë@8-12"}},
+		{"should ignore lone @ signs", "meet @ noon", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range ParseMentions(tt.content) {
+				got = append(got, fmt.Sprintf("%s@%d-%d", m.Username, m.Start, m.End))
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.expected, ", ") {
+				t.Errorf("expected mentions %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrMFAAlreadyEnabled is returned when enrolling a user who already has two-factor authentication enabled.
+var ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// MFA represents the TOTP two-factor authentication settings of a user.
+type MFA struct {
+	UserID       int64  `json:"user_id"`
+	Secret       []byte `json:"-"`       // TOTP secret, encrypted
+	Enabled      bool   `json:"enabled"` // Enabled once the user verified a first code
+	LastUsedStep int64  `json:"-"`       // Last accepted time step, codes from it or earlier are rejected
+	CreatedAt    string `json:"created_at"`
+}
+
+// MFAStore implements the Storage interface for two-factor authentication settings.
+type MFAStore struct {
+	db *sql.DB
+}
+
+// GetByUserID retrieves the two-factor authentication settings of a user.
+func (m *MFAStore) GetByUserID(ctx context.Context, userID int64) (*MFA, error) {
+	query := `SELECT user_id, secret, enabled, last_used_step, created_at FROM user_mfa WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	mfa := &MFA{}
+	err := m.db.QueryRowContext(ctx, query, userID).
+		Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep, &mfa.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return mfa, nil
+}
+
+// Enroll stores a new, not yet enabled, secret for a user, replacing any pending enrollment.
+func (m *MFAStore) Enroll(ctx context.Context, userID int64, secret []byte) error {
+	query := `INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW()
+			  WHERE user_mfa.enabled = FALSE`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+
+	return nil
+}
+
+// Enable enables two-factor authentication for a user after a first code was verified at the given time step, and
+// replaces the recovery codes of the user with the given hashed codes.
+func (m *MFAStore) Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error {
+	return withTx(m.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE user_mfa SET enabled = TRUE, enabled_at = NOW(), last_used_step = $2
+				  WHERE user_id = $1 AND enabled = FALSE`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		result, err := tx.ExecContext(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrMFAAlreadyEnabled
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		for _, code := range recoveryCodes {
+			query := `INSERT INTO mfa_recovery_codes (user_id, code) VALUES ($1, $2)`
+			if _, err := tx.ExecContext(ctx, query, userID, code); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Disable removes the two-factor authentication settings and recovery codes of a user.
+func (m *MFAStore) Disable(ctx context.Context, userID int64) error {
+	return withTx(m.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// UseStep records that a code from the given time step was accepted. It returns ErrNotFound if a code from that step
+// or a later one was already accepted, so that a code cannot be replayed.
+func (m *MFAStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	query := `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes a hashed recovery code of a user. It returns ErrNotFound if the code does not exist or
+// was already used.
+func (m *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
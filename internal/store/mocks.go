@@ -8,7 +8,12 @@ import (
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:         &MockUserStore{},
+		Sessions:      &MockSessionStore{},
+		MFA:           &MockMFAStore{},
+		LoginFailures: &MockLoginFailureStore{},
+		Identities:    &MockIdentityStore{states: map[string]*OIDCLoginState{}},
+		Audit:         &MockAuditStore{},
 	}
 }
 
@@ -36,6 +41,145 @@ func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *User, email s
 	return nil
 }
 
-func (m *MockUserStore) Activate(ctx context.Context, token string) error {
+func (m *MockUserStore) Activate(ctx context.Context, token string) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return nil
+}
+
+func (m *MockUserStore) RotateInvitation(ctx context.Context, email, token string, exp time.Duration) (*User, error) {
+	return &User{}, nil
+}
+
+func (m *MockUserStore) GetPendingInvitations(ctx context.Context, fq PaginatedFeedQuery) ([]*Invitation, error) {
+	return []*Invitation{}, nil
+}
+
+func (m *MockUserStore) CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	return nil
+}
+
+func (m *MockUserStore) DeleteUnactivated(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	return 0, nil
+}
+
+// MockSessionStore is a mock implementation of the SessionStore interface for testing purposes.
+type MockSessionStore struct {
+}
+
+func (m *MockSessionStore) Create(ctx context.Context, session *Session, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockSessionStore) GetByID(ctx context.Context, id string) (*Session, error) {
+	return &Session{ID: id}, nil
+}
+
+func (m *MockSessionStore) Rotate(ctx context.Context, token, newToken string, exp time.Duration) (*Session, error) {
+	return &Session{}, nil
+}
+
+func (m *MockSessionStore) Revoke(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m *MockSessionStore) RevokeByToken(ctx context.Context, token string) error {
+	return nil
+}
+
+// MockMFAStore is a mock implementation of the MFAStore interface for testing purposes, for users without
+// two-factor authentication.
+type MockMFAStore struct {
+}
+
+func (m *MockMFAStore) GetByUserID(ctx context.Context, userID int64) (*MFA, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockMFAStore) Enroll(ctx context.Context, userID int64, secret []byte) error {
+	return nil
+}
+
+func (m *MockMFAStore) Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error {
+	return nil
+}
+
+func (m *MockMFAStore) Disable(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockMFAStore) UseStep(ctx context.Context, userID int64, step int64) error {
 	return nil
 }
+
+func (m *MockMFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	return nil
+}
+
+// MockLoginFailureStore is a mock implementation of the LoginFailureStore interface for testing purposes, that never
+// locks anything.
+type MockLoginFailureStore struct {
+}
+
+func (m *MockLoginFailureStore) GetLockedUntil(ctx context.Context, kind, key string) (*time.Time, error) {
+	return nil, nil
+}
+
+func (m *MockLoginFailureStore) RecordFailure(ctx context.Context, kind, key string, window time.Duration) (int, error) {
+	return 1, nil
+}
+
+func (m *MockLoginFailureStore) Lock(ctx context.Context, kind, key string, d time.Duration) error {
+	return nil
+}
+
+func (m *MockLoginFailureStore) Reset(ctx context.Context, kind, key string) error {
+	return nil
+}
+
+// MockIdentityStore is a mock implementation of the IdentityStore interface for testing purposes. It keeps login
+// states in memory so that a login can be completed, and knows no identities.
+type MockIdentityStore struct {
+	states map[string]*OIDCLoginState
+}
+
+func (m *MockIdentityStore) GetByProviderSubject(ctx context.Context, provider, subject string) (*Identity, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockIdentityStore) Link(ctx context.Context, identity *Identity) error {
+	return nil
+}
+
+func (m *MockIdentityStore) CreateLoginState(ctx context.Context, state *OIDCLoginState, hash string, exp time.Duration) error {
+	m.states[hash] = state
+	return nil
+}
+
+func (m *MockIdentityStore) ConsumeLoginState(ctx context.Context, hash string) (*OIDCLoginState, error) {
+	state, ok := m.states[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(m.states, hash)
+
+	return state, nil
+}
+
+// MockAuditStore is a mock implementation of the AuditStore interface for testing purposes.
+type MockAuditStore struct {
+}
+
+func (m *MockAuditStore) Create(ctx context.Context, event *AuditEvent) error {
+	return nil
+}
+
+func (m *MockAuditStore) List(ctx context.Context, q AuditQuery) ([]*AuditEvent, error) {
+	return []*AuditEvent{}, nil
+}
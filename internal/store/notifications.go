@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Types of notifications
+const (
+	NotificationTypeMention = "mention" // The actor mentioned the user in a post or comment
+)
+
+// Notification represents something that happened to a user, such as being mentioned.
+type Notification struct {
+	ID        int64       `json:"id"`
+	UserID    int64       `json:"user_id"` // ID of the notified user
+	Type      string      `json:"type"`    // Type of the notification, one of the NotificationType constants
+	Actor     CommentUser `json:"actor"`   // User whose action caused the notification
+	PostID    int64       `json:"post_id"`
+	CommentID *int64      `json:"comment_id,omitempty"` // ID of the comment, for notifications about a comment
+	ReadAt    *string     `json:"read_at"`              // When the user read the notification, nil while unread
+	CreatedAt string      `json:"created_at"`
+}
+
+// NotificationStore implements the Storage interface for notifications.
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// ListByUserID retrieves a page of the notifications of a user with their actors, newest first. Notifications about
+// posts the user can no longer see are left out.
+func (s *NotificationStore) ListByUserID(ctx context.Context, userID int64, unreadOnly bool, fq PaginatedFeedQuery) ([]*Notification, error) {
+	query := `SELECT n.id, n.user_id, n.type, n.post_id, n.comment_id, n.read_at, n.created_at, u.id, u.username
+			  FROM notifications n
+			  JOIN posts p ON p.id = n.post_id
+			  JOIN users u ON u.id = n.actor_id
+			  WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL) AND ` + visibleTo("p", "n.user_id") + `
+			  ORDER BY n.created_at DESC, n.id DESC
+			  LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, unreadOnly, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.PostID, &n.CommentID, &n.ReadAt, &n.CreatedAt, &n.Actor.ID,
+			&n.Actor.Username)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// MarkRead marks a notification of a user read. It returns ErrNotFound if the user has no such notification.
+func (s *NotificationStore) MarkRead(ctx context.Context, userID, notificationID int64) error {
+	query := `UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, notificationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread notification of a user read and returns how many there were.
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// notifyMentions notifies the users mentioned in posts, or in one of their comments, within a transaction. Users are
+// notified once per post or comment, only if they can see the post, and never of mentioning themselves.
+func notifyMentions(ctx context.Context, tx *sql.Tx, postIDs []int64, commentID *int64) error {
+	query := `INSERT INTO notifications (user_id, type, actor_id, post_id, comment_id)
+			  SELECT DISTINCT m.user_id, 'mention', COALESCE(c.user_id, p.user_id), m.post_id, m.comment_id
+			  FROM mentions m
+			  JOIN posts p ON p.id = m.post_id
+			  LEFT JOIN comments c ON c.id = m.comment_id
+			  WHERE m.post_id = ANY($1) AND m.comment_id IS NOT DISTINCT FROM $2::BIGINT AND
+			  m.user_id <> COALESCE(c.user_id, p.user_id) AND ` + visibleTo("p", "m.user_id") + `
+			  ON CONFLICT DO NOTHING`
+
+	_, err := tx.ExecContext(ctx, query, pq.Array(postIDs), commentID)
+	return err
+}
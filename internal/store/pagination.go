@@ -1,6 +1,8 @@
 package store
 
 import (
+	"encoding/base64"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -86,3 +88,88 @@ func parseTime(s string) string {
 
 	return t.Format(time.DateTime)
 }
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CommentThreadQuery represents the query parameters for retrieving threaded comments.
+type CommentThreadQuery struct {
+	Limit        int    `json:"limit" validate:"gte=1,lte=50"`   // Maximum number of comments to return at the top level
+	MaxDepth     int    `json:"depth" validate:"gte=0,lte=5"`    // Maximum number of reply levels to load below them
+	RepliesLimit int    `json:"replies" validate:"gte=1,lte=20"` // Maximum number of replies to load per comment
+	Cursor       string `json:"cursor"`                          // Cursor returned by a previous page, empty for the first page
+}
+
+// Parse extracts the thread parameters from the HTTP request and returns a CommentThreadQuery.
+func (q CommentThreadQuery) Parse(r *http.Request) (CommentThreadQuery, error) {
+	qs := r.URL.Query()
+
+	// Parse limit
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	// Parse depth
+	depth := qs.Get("depth")
+	if depth != "" {
+		d, err := strconv.Atoi(depth)
+		if err != nil {
+			return q, err
+		}
+
+		q.MaxDepth = d
+	}
+
+	// Parse replies limit
+	replies := qs.Get("replies")
+	if replies != "" {
+		rl, err := strconv.Atoi(replies)
+		if err != nil {
+			return q, err
+		}
+
+		q.RepliesLimit = rl
+	}
+
+	// Parse cursor
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		if _, err := decodeCursor(cursor); err != nil {
+			return q, err
+		}
+
+		q.Cursor = cursor
+	}
+
+	return q, nil
+}
+
+// EncodeCursor encodes the ID of the last item of a page into an opaque cursor.
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor decodes a cursor created by EncodeCursor. An empty cursor decodes to 0, the start of the list.
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return id, nil
+}
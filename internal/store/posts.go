@@ -3,10 +3,37 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 
 	"github.com/lib/pq"
 )
 
+// Kinds of posts
+const (
+	PostKindPost   = "post"   // Original post
+	PostKindRepost = "repost" // Plain share of another post, without content of its own
+	PostKindQuote  = "quote"  // Share of another post with commentary
+)
+
+// Visibilities of posts
+const (
+	PostVisibilityPublic    = "public"    // Visible to anyone and in the feeds of followers
+	PostVisibilityFollowers = "followers" // Visible to the author and their followers only
+	PostVisibilityPrivate   = "private"   // Visible to the author only
+	PostVisibilityUnlisted  = "unlisted"  // Visible to anyone with the link, but kept out of the feeds of others
+)
+
+// Publication statuses of posts
+const (
+	PostStatusDraft     = "draft"     // Visible to the author only, until they publish it
+	PostStatusScheduled = "scheduled" // Visible to the author only, until it is published at PublishAt
+	PostStatusPublished = "published" // Visible according to the visibility of the post
+)
+
+// ErrDuplicateRepost is returned when a user reposts a post they already reposted.
+var ErrDuplicateRepost = errors.New("post already reposted")
+
 // Post represents a blog post in the system.
 type Post struct {
 	ID        int64      `json:"id"`
@@ -19,12 +46,36 @@ type Post struct {
 	Version   int64      `json:"version"`  // Version of the post for optimistic concurrency control
 	Comments  []*Comment `json:"comments"` // Comments associated with the post
 	User      *User      `json:"user"`     // User who created the post
+	// CommentsCursor is the cursor to load the comment threads after the ones embedded in Comments
+	CommentsCursor string  `json:"comments_cursor,omitempty"`
+	Kind           string  `json:"kind"`                  // Kind of the post, one of the PostKind constants
+	Visibility     string  `json:"visibility"`            // Who can see the post, one of the PostVisibility constants
+	Status         string  `json:"status"`                // Publication status of the post, one of the PostStatus constants
+	PublishAt      *string `json:"publish_at,omitempty"`  // When a scheduled post gets published
+	OriginalID     *int64  `json:"original_id,omitempty"` // ID of the reposted or quoted post
+	Original       *Post   `json:"original,omitempty"`    // Reposted or quoted post with its author, when loaded
+	// OriginalDeleted tells that the quoted post was deleted, leaving the quote as a tombstone
+	OriginalDeleted bool       `json:"original_deleted,omitempty"`
+	Media           []*Media   `json:"media,omitempty"`    // Attached files, when loaded
+	Mentions        []*Mention `json:"mentions,omitempty"` // Users mentioned in the content, when loaded
 }
 
-// PostsForFeed represents a post with additional information for the user feed.
+// PostsForFeed represents a post with additional information for the user feed. For reposts, the counts and reactions
+// are those of the original post.
 type PostsForFeed struct {
 	Post
-	CommentsCount int64 `json:"comments_count"` // Number of comments on the post
+	CommentsCount   int64            `json:"comments_count"`   // Number of comments on the post
+	ReactionCounts  map[string]int64 `json:"reaction_counts"`  // Number of reactions to the post, by type
+	ViewerReactions []string         `json:"viewer_reactions"` // Types of the reactions of the viewing user
+}
+
+// PostRevision represents a version of the title and content of a post.
+type PostRevision struct {
+	PostID    int64  `json:"post_id"`
+	Version   int64  `json:"version"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"` // When the version was written
 }
 
 // Implementing the Storage interface for posts
@@ -32,44 +83,155 @@ type PostStore struct {
 	db *sql.DB
 }
 
-// Create inserts a new post into the database.
+// Create inserts a new post into the database, attaches the files listed in Media and records the users mentioned in
+// the content, notifying those who can see the post. Posts without a kind are original posts, posts without a
+// visibility are public and posts without a status are published. It returns ErrDuplicateRepost if the user already
+// reposted the original, ErrNotFound if the original does not exist and ErrMediaUnavailable if a file cannot be
+// attached.
 func (p *PostStore) Create(ctx context.Context, post *Post) error {
-	query := `INSERT INTO posts (title, content, user_id, tags) VALUES ($1, $2, $3, $4) 
-			RETURNING id, created_at, updated_at`
+	query := `INSERT INTO posts (title, content, user_id, tags, kind, original_id, visibility, status, publish_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at`
+
+	if post.Kind == "" {
+		post.Kind = PostKindPost
+	}
+	if post.Visibility == "" {
+		post.Visibility = PostVisibilityPublic
+	}
+	if post.Status == "" {
+		post.Status = PostStatusPublished
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := p.db.QueryRowContext(ctx, query, post.Title, post.Content, post.UserID, pq.Array(post.Tags)).
-		Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
-	if err != nil {
-		return err
-	}
+	return withTx(p.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, post.Title, post.Content, post.UserID, pq.Array(post.Tags), post.Kind,
+			post.OriginalID, post.Visibility, post.Status, post.PublishAt).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok {
+				switch pqErr.Code {
+				case "23505":
+					return ErrDuplicateRepost
+				case "23503":
+					return ErrNotFound
+				}
+			}
+			return err
+		}
 
-	return nil
+		if err := attachMedia(ctx, tx, post); err != nil {
+			return err
+		}
+
+		post.Mentions, err = saveMentions(ctx, tx, post.ID, nil, post.Content)
+		return err
+	})
 }
 
 // GetByID retrieves a post by its ID from the database with its associated comments.
 func (p *PostStore) GetByID(ctx context.Context, postID string) (*Post, error) {
-	query := `SELECT id, title, content, user_id, tags, created_at, updated_at, version FROM posts WHERE id = $1`
+	query := `SELECT id, title, content, user_id, tags, created_at, updated_at, version, kind, original_id, visibility,
+			  status, publish_at
+			  FROM posts WHERE id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	post := &Post{}
 	err := p.db.QueryRowContext(ctx, query, postID).Scan(&post.ID, &post.Title, &post.Content,
-		&post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version)
+		&post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Kind, &post.OriginalID,
+		&post.Visibility, &post.Status, &post.PublishAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
+	post.OriginalDeleted = post.Kind == PostKindQuote && post.OriginalID == nil
 
 	return post, nil
 }
 
-// Delete removes a post by its ID from the database.
+// LoadOriginals attaches to each repost and quote the post it shares, with its author. Tombstoned quotes and shares
+// of posts the viewing user cannot see are left without one.
+func (p *PostStore) LoadOriginals(ctx context.Context, viewerID int64, posts []*Post) error {
+	var ids []int64
+	for _, post := range posts {
+		if post.OriginalID != nil {
+			ids = append(ids, *post.OriginalID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.version, p.kind,
+			  p.original_id, p.visibility, p.status, p.publish_at, u.username
+			  FROM posts p
+			  JOIN users u ON u.id = p.user_id
+			  WHERE p.id = ANY($1) AND ` + visibleTo("p", "$2")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	originals := make(map[int64]*Post, len(ids))
+	for rows.Next() {
+		original := &Post{User: &User{}}
+		err := rows.Scan(&original.ID, &original.Title, &original.Content, &original.UserID, pq.Array(&original.Tags),
+			&original.CreatedAt, &original.UpdatedAt, &original.Version, &original.Kind, &original.OriginalID,
+			&original.Visibility, &original.Status, &original.PublishAt, &original.User.Username)
+		if err != nil {
+			return err
+		}
+		original.User.ID = original.UserID
+		original.OriginalDeleted = original.Kind == PostKindQuote && original.OriginalID == nil
+		originals[original.ID] = original
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		if post.OriginalID != nil {
+			post.Original = originals[*post.OriginalID]
+		}
+	}
+
+	return nil
+}
+
+// DeleteRepost removes the repost of a post by a user. It returns ErrNotFound if the user did not repost it.
+func (p *PostStore) DeleteRepost(ctx context.Context, originalID, userID int64) error {
+	query := `DELETE FROM posts WHERE original_id = $1 AND user_id = $2 AND kind = 'repost'`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, query, originalID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete removes a post by its ID from the database. Its comments, reactions, bookmarks and reposts are deleted with
+// it, while quotes of it are kept as tombstones.
 func (p *PostStore) Delete(ctx context.Context, postID string) error {
 	query := `DELETE FROM posts WHERE id = $1`
 
@@ -93,27 +255,108 @@ func (p *PostStore) Delete(ctx context.Context, postID string) error {
 	return nil
 }
 
-// Update modifies an existing post in the database.
+// Update modifies an existing post in the database and records the users mentioned in the new content. When the title
+// or content changes, the version it replaces is kept as a revision in the same transaction and the version is bumped.
+// Other changes, such as the visibility or the publication, keep the version.
 func (p *PostStore) Update(ctx context.Context, post *Post) error {
-	query := `UPDATE posts SET title = $1, content = $2, version=version+1, updated_at = NOW() 
-			WHERE id = $3 AND version=$4 RETURNING updated_at, version`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(p.db, ctx, func(tx *sql.Tx) error {
+		// Lock the replaced version, so that concurrent updates of it fail the version check once this one commits
+		query := `SELECT title, content, COALESCE(updated_at, created_at) FROM posts WHERE id = $1 AND version = $2 FOR UPDATE`
+
+		revision := &PostRevision{PostID: post.ID, Version: post.Version}
+		err := tx.QueryRowContext(ctx, query, post.ID, post.Version).Scan(&revision.Title, &revision.Content, &revision.CreatedAt)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		edited := revision.Title != post.Title || revision.Content != post.Content
+		if edited {
+			query = `INSERT INTO post_revisions (post_id, version, title, content, created_at) VALUES ($1, $2, $3, $4, $5)`
+			_, err = tx.ExecContext(ctx, query, revision.PostID, revision.Version, revision.Title, revision.Content, revision.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		// A post published by the workers meanwhile stays published, and publishing a post makes it new in the feeds
+		query = `UPDATE posts SET title = $1, content = $2, visibility = $3,
+			status = CASE WHEN status = 'published' THEN status ELSE $4 END,
+			publish_at = CASE WHEN status = 'published' OR $4 = 'published' THEN NULL ELSE $5::TIMESTAMPTZ END,
+			created_at = CASE WHEN status <> 'published' AND $4 = 'published' THEN NOW() ELSE created_at END,
+			version = CASE WHEN $7 THEN version + 1 ELSE version END, updated_at = NOW()
+			WHERE id = $6 RETURNING created_at, updated_at, version, status, publish_at`
+		err = tx.QueryRowContext(ctx, query, post.Title, post.Content, post.Visibility, post.Status, post.PublishAt, post.ID, edited).
+			Scan(&post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt)
+		if err != nil {
+			return err
+		}
+
+		// Users already notified are not notified again, those who could not see the post until it was published now are
+		post.Mentions, err = saveMentions(ctx, tx, post.ID, nil, post.Content)
+		return err
+	})
+}
+
+// GetRevisions retrieves the previous versions of a post, newest first.
+func (p *PostStore) GetRevisions(ctx context.Context, postID int64) ([]*PostRevision, error) {
+	query := `SELECT post_id, version, title, content, created_at FROM post_revisions
+			  WHERE post_id = $1 ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*PostRevision{}
+	for rows.Next() {
+		revision := &PostRevision{}
+		err := rows.Scan(&revision.PostID, &revision.Version, &revision.Title, &revision.Content, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetRevision retrieves a previous version of a post. It returns ErrNotFound for the current version, which only
+// lives in posts.
+func (p *PostStore) GetRevision(ctx context.Context, postID, version int64) (*PostRevision, error) {
+	query := `SELECT post_id, version, title, content, created_at FROM post_revisions WHERE post_id = $1 AND version = $2`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := p.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).
-		Scan(&post.UpdatedAt, &post.Version)
+	revision := &PostRevision{}
+	err := p.db.QueryRowContext(ctx, query, postID, version).
+		Scan(&revision.PostID, &revision.Version, &revision.Title, &revision.Content, &revision.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return ErrNotFound
+			return nil, ErrNotFound
 		}
-		return err
+		return nil, err
 	}
 
-	return nil
+	return revision, nil
 }
 
-// GetUserFeed retrieves posts for a specific user, including comments count.
+// GetUserFeed retrieves the posts of a user, drafts included, and the published public and followers-only posts of
+// the users they follow, including comments count. Reposts of the same post are collapsed into the latest one, reposts of posts the user
+// cannot see are left out, and filters apply to the original of reposts.
 func (p *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostsForFeed, error) {
 	// Handle sort parameter safely
 	sortDir := "DESC"
@@ -126,28 +369,39 @@ func (p *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 	var queryArgs []interface{}
 
 	if len(fq.Tags) > 0 {
-		tagsCondition = "AND p.tags && $5"
+		tagsCondition = "AND COALESCE(o.tags, p.tags) && $5"
 		queryArgs = []interface{}{userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags)}
 	} else {
 		tagsCondition = ""
 		queryArgs = []interface{}{userID, fq.Limit, fq.Offset, fq.Search}
 	}
 
+	// The subject of a feed entry is the post its counts are about: the original for reposts, the post itself otherwise
 	query := `
+   WITH entries AS (
+    SELECT DISTINCT ON (p.kind = 'repost', COALESCE(o.id, p.id))
+     p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags, p.kind, p.original_id,
+     p.visibility, p.status, p.publish_at, COALESCE(o.id, p.id) AS subject_id
+    FROM posts p
+    LEFT JOIN posts o ON o.id = p.original_id AND p.kind = 'repost'
+    WHERE
+     (p.user_id = $1 OR (p.status = 'published' AND p.visibility IN ('public', 'followers') AND
+      EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = p.user_id))) AND
+     (o.id IS NULL OR ` + visibleTo("o", "$1") + `) AND
+     ($4 = '' OR COALESCE(o.title, p.title) ILIKE '%' || $4 || '%' OR COALESCE(o.content, p.content) ILIKE '%' || $4 || '%')
+     ` + tagsCondition + `
+    ORDER BY p.kind = 'repost', COALESCE(o.id, p.id), p.created_at DESC, p.id DESC
+   )
    SELECT
-    p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags,
-    u.username,
-    COUNT(c.id) AS comments_count
-   FROM posts p
-   LEFT JOIN comments c ON c.post_id = p.id
-   LEFT JOIN users u ON p.user_id = u.id
-   LEFT JOIN followers f ON f.follower_id = p.user_id
-   WHERE
-    (f.user_id = $1 OR p.user_id = $1) AND
-    ($4 = '' OR p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
-    ` + tagsCondition + `
-  GROUP BY p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags, u.username
-  ORDER BY p.created_at ` + sortDir + `
+    e.id, e.user_id, e.title, e.content, e.created_at, e.updated_at, e.version, e.tags, e.kind, e.original_id,
+    e.visibility, e.status, e.publish_at, u.username,
+    (SELECT COUNT(*) FROM comments c WHERE c.post_id = e.subject_id) AS comments_count,
+    s.reaction_counts,
+    ARRAY(SELECT r.type FROM post_reactions r WHERE r.post_id = e.subject_id AND r.user_id = $1 ORDER BY r.type) AS viewer_reactions
+   FROM entries e
+   JOIN posts s ON s.id = e.subject_id
+   LEFT JOIN users u ON e.user_id = u.id
+  ORDER BY e.created_at ` + sortDir + `, e.id ` + sortDir + `
   LIMIT $2 OFFSET $3
  `
 
@@ -164,6 +418,7 @@ func (p *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 	for rows.Next() {
 		var post PostsForFeed
 		post.User = &User{} // Initialize User pointer
+		var reactionCounts []byte
 
 		err := rows.Scan(
 			&post.ID,
@@ -174,12 +429,24 @@ func (p *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 			&post.UpdatedAt,
 			&post.Version,
 			pq.Array(&post.Tags),
+			&post.Kind,
+			&post.OriginalID,
+			&post.Visibility,
+			&post.Status,
+			&post.PublishAt,
 			&post.User.Username,
 			&post.CommentsCount,
+			&reactionCounts,
+			pq.Array(&post.ViewerReactions),
 		)
 		if err != nil {
 			return nil, err
 		}
+		post.OriginalDeleted = post.Kind == PostKindQuote && post.OriginalID == nil
+
+		if err := json.Unmarshal(reactionCounts, &post.ReactionCounts); err != nil {
+			return nil, err
+		}
 
 		feed = append(feed, post)
 	}
@@ -188,5 +455,73 @@ func (p *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 		return nil, err
 	}
 
+	// Attach the reposted and quoted posts with their authors
+	posts := make([]*Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+	if err := p.LoadOriginals(ctx, userID, posts); err != nil {
+		return nil, err
+	}
+
 	return feed, nil
 }
+
+// visibleTo returns an SQL condition telling whether the post of a table alias is visible to the user whose ID is the
+// given SQL expression. Authors see all their posts, others only published ones.
+func visibleTo(alias, viewerID string) string {
+	return `(` + alias + `.user_id = ` + viewerID + ` OR (` + alias + `.status = 'published' AND
+		(` + alias + `.visibility IN ('public', 'unlisted') OR (` + alias + `.visibility = 'followers' AND
+		 EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = ` + viewerID + ` AND vf.follower_id = ` + alias + `.user_id)))))`
+}
+
+// PublishScheduled publishes up to limit scheduled posts whose publication time is due and returns how many it
+// published. Due posts are locked with SKIP LOCKED, so that several API replicas publish different posts at once
+// instead of waiting on each other. Published posts date from their publication time, and the users mentioned in them
+// are notified once they can see them.
+func (p *PostStore) PublishScheduled(ctx context.Context, limit int) (int64, error) {
+	query := `WITH due AS (
+				  SELECT id FROM posts
+				  WHERE status = 'scheduled' AND publish_at <= NOW()
+				  ORDER BY publish_at
+				  LIMIT $1
+				  FOR UPDATE SKIP LOCKED
+			  )
+			  UPDATE posts p SET status = 'published', created_at = p.publish_at, publish_at = NULL
+			  FROM due WHERE p.id = due.id
+			  RETURNING p.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var published []int64
+	err := withTx(p.db, ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			published = append(published, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		if len(published) == 0 {
+			return nil
+		}
+		return notifyMentions(ctx, tx, published, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(published)), nil
+}
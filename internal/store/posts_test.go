@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestUpdatePost(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		content  string
+		revision bool // whether the replaced version is kept as a revision
+	}{
+		{"should keep a revision when the content changes", "Title", "New content", true},
+		{"should keep a revision when the title changes", "New title", "Content", true},
+		{"should not keep a revision when only the visibility changes", "Title", "Content", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			version := int64(3)
+			if tt.revision {
+				version++
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT title, content, COALESCE\(updated_at, created_at\) FROM posts`).
+				WithArgs(1, 3).
+				WillReturnRows(sqlmock.NewRows([]string{"title", "content", "updated_at"}).AddRow("Title", "Content", time.Now()))
+			if tt.revision {
+				mock.ExpectExec(`INSERT INTO post_revisions`).
+					WithArgs(1, 3, "Title", "Content", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectQuery(`UPDATE posts SET title`).
+				WithArgs(tt.title, tt.content, PostVisibilityPrivate, PostStatusPublished, nil, 1, tt.revision).
+				WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "version", "status", "publish_at"}).
+					AddRow("2026-01-01", "2026-01-02", version, PostStatusPublished, nil))
+			mock.ExpectExec(`DELETE FROM mentions`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+
+			post := &Post{ID: 1, Version: 3, Title: tt.title, Content: tt.content,
+				Visibility: PostVisibilityPrivate, Status: PostStatusPublished}
+
+			store := &PostStore{db}
+			if err := store.Update(context.Background(), post); err != nil {
+				t.Fatalf("Expected the post to be updated, got %v", err)
+			}
+			if post.Version != version {
+				t.Errorf("Expected version %d, got %d", version, post.Version)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// queryInOrder matches queries containing the given fragments in order, ignoring differences in whitespace
+func queryInOrder(fragments ...string) sqlmock.QueryMatcher {
+	compact := func(s string) string { return strings.Join(strings.Fields(s), " ") }
+
+	return sqlmock.QueryMatcherFunc(func(_, actual string) error {
+		rest := compact(actual)
+		for _, fragment := range fragments {
+			i := strings.Index(rest, compact(fragment))
+			if i < 0 {
+				return fmt.Errorf("query does not contain %q in order", fragment)
+			}
+			rest = rest[i+len(compact(fragment)):]
+		}
+		return nil
+	})
+}
+
+func TestGetUserFeedVisibility(t *testing.T) {
+	const viewerID = 2
+
+	tests := []struct {
+		name      string
+		fragments []string
+	}{
+		{
+			// Posts of users the viewer does not follow never match, and private and unlisted posts of those they
+			// follow are left out
+			"should only show the published public and followers-only posts of followed users, and all own posts",
+			[]string{`WHERE (p.user_id = $1 OR (p.status = 'published' AND p.visibility IN ('public', 'followers') AND
+				EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = p.user_id)))`},
+		},
+		{
+			// The original is checked before reposts are collapsed, so that a hidden original cannot come back
+			// through another repost of it
+			"should leave out reposts of originals hidden from the viewer before collapsing reposts",
+			[]string{
+				`SELECT DISTINCT ON (p.kind = 'repost', COALESCE(o.id, p.id))`,
+				`(o.id IS NULL OR ` + visibleTo("o", "$1") + `)`,
+				`ORDER BY p.kind = 'repost', COALESCE(o.id, p.id)`,
+				`FROM entries e`,
+			},
+		},
+		{
+			"should only show the originals of reposts to their author, or to anyone once published and not private",
+			[]string{`(o.user_id = $1 OR (o.status = 'published' AND (o.visibility IN ('public', 'unlisted') OR
+				(o.visibility = 'followers' AND EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = $1 AND
+				vf.follower_id = o.user_id)))))`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(queryInOrder(tt.fragments...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`entries`).
+				WithArgs(viewerID, 20, 0, "").
+				WillReturnRows(sqlmock.NewRows(nil))
+
+			store := &PostStore{db}
+			fq := PaginatedFeedQuery{Limit: 20, Offset: 0, Sort: "desc"}
+			if _, err := store.GetUserFeed(context.Background(), viewerID, fq); err != nil {
+				t.Fatalf("Expected the feed to be queried, got %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Types of reactions users can add to posts
+const (
+	ReactionLike  = "like"
+	ReactionLove  = "love"
+	ReactionLaugh = "laugh"
+	ReactionWow   = "wow"
+	ReactionSad   = "sad"
+	ReactionAngry = "angry"
+)
+
+// ReactionTypes lists every type of reaction, as allowed by the post_reactions table
+var ReactionTypes = []string{ReactionLike, ReactionLove, ReactionLaugh, ReactionWow, ReactionSad, ReactionAngry}
+
+// Reaction represents a reaction of a user to a post.
+type Reaction struct {
+	PostID    int64  `json:"post_id"`
+	UserID    int64  `json:"user_id"`
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	User      *User  `json:"user,omitempty"` // User who reacted, when listing the reactions of a post
+}
+
+// ReactionStore implements the Storage interface for post reactions.
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Add records a reaction of a user to a post. Adding a reaction the user already made does nothing.
+func (s *ReactionStore) Add(ctx context.Context, reaction *Reaction) error {
+	query := `INSERT INTO post_reactions (post_id, user_id, type) VALUES ($1, $2, $3)
+			  ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, reaction.PostID, reaction.UserID, reaction.Type)
+	return err
+}
+
+// Remove deletes a reaction of a user to a post. It returns ErrNotFound if the user did not react that way.
+func (s *ReactionStore) Remove(ctx context.Context, postID, userID int64, reactionType string) error {
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND type = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, postID, userID, reactionType)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListByPostID retrieves a page of the reactions to a post with the users who made them, newest first. An empty
+// reaction type lists reactions of every type.
+func (s *ReactionStore) ListByPostID(ctx context.Context, postID int64, reactionType string, fq PaginatedFeedQuery) ([]*Reaction, error) {
+	query := `SELECT r.post_id, r.user_id, r.type, r.created_at, u.username
+			  FROM post_reactions r
+			  JOIN users u ON u.id = r.user_id
+			  WHERE r.post_id = $1 AND ($2 = '' OR r.type = $2)
+			  ORDER BY r.created_at DESC, r.user_id
+			  LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID, reactionType, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := []*Reaction{}
+	for rows.Next() {
+		reaction := &Reaction{User: &User{}}
+		err := rows.Scan(&reaction.PostID, &reaction.UserID, &reaction.Type, &reaction.CreatedAt, &reaction.User.Username)
+		if err != nil {
+			return nil, err
+		}
+		reaction.User.ID = reaction.UserID
+		reactions = append(reactions, reaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reactions, nil
+}
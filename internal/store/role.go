@@ -4,13 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateRole     = errors.New("role already exists")
+	ErrRoleInUse         = errors.New("role is the primary role of some users")
+	ErrUnknownPermission = errors.New("unknown permission")
 )
 
 type Role struct {
-	ID          int64  `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Level       int    `json:"level"`
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Level       int      `json:"level"`
+	Permissions []string `json:"permissions,omitempty"` // Names of the permissions granted by the role
 }
 
 // Implements the Storage interface for roles
@@ -34,3 +44,281 @@ func (s *RoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
 
 	return role, nil
 }
+
+// GetUserPermissions retrieves the names of the permissions granted to a user by all of their roles.
+func (s *RoleStore) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	query := `SELECT DISTINCT p.name FROM user_roles ur
+			  JOIN role_permissions rp ON rp.role_id = ur.role_id
+			  JOIN permissions p ON p.id = rp.permission_id
+			  WHERE ur.user_id = $1
+			  ORDER BY p.name`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// List retrieves all roles with their permissions, by level.
+func (s *RoleStore) List(ctx context.Context) ([]*Role, error) {
+	query := `SELECT r.id, r.name, COALESCE(r.description, ''), r.level,
+			  COALESCE(ARRAY_AGG(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+			  FROM roles r
+			  LEFT JOIN role_permissions rp ON rp.role_id = r.id
+			  LEFT JOIN permissions p ON p.id = rp.permission_id
+			  GROUP BY r.id
+			  ORDER BY r.level, r.name`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		role := &Role{}
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Level, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetByID retrieves a role with its permissions by ID.
+func (s *RoleStore) GetByID(ctx context.Context, roleID int64) (*Role, error) {
+	query := `SELECT r.id, r.name, COALESCE(r.description, ''), r.level,
+			  COALESCE(ARRAY_AGG(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+			  FROM roles r
+			  LEFT JOIN role_permissions rp ON rp.role_id = r.id
+			  LEFT JOIN permissions p ON p.id = rp.permission_id
+			  WHERE r.id = $1
+			  GROUP BY r.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	role := &Role{}
+	err := s.db.QueryRowContext(ctx, query, roleID).
+		Scan(&role.ID, &role.Name, &role.Description, &role.Level, pq.Array(&role.Permissions))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// Create inserts a role with its permissions.
+func (s *RoleStore) Create(ctx context.Context, role *Role) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO roles (name, description, level) VALUES ($1, $2, $3) RETURNING id`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, role.Name, role.Description, role.Level).Scan(&role.ID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrDuplicateRole
+			}
+			return err
+		}
+
+		return setRolePermissions(ctx, tx, role)
+	})
+}
+
+// Update replaces the name, description, level and permissions of a role.
+func (s *RoleStore) Update(ctx context.Context, role *Role) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE roles SET name = $1, description = $2, level = $3 WHERE id = $4`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, role.Name, role.Description, role.Level, role.ID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrDuplicateRole
+			}
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		return setRolePermissions(ctx, tx, role)
+	})
+}
+
+// Delete removes a role, which is taken away from the users holding it. A role that is the primary role of a user
+// cannot be deleted and ErrRoleInUse is returned.
+func (s *RoleStore) Delete(ctx context.Context, roleID int64) error {
+	query := `DELETE FROM roles WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, roleID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrRoleInUse
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetUserIDs retrieves the IDs of the users holding a role.
+func (s *RoleStore) GetUserIDs(ctx context.Context, roleID int64) ([]int64, error) {
+	query := `SELECT user_id FROM user_roles WHERE role_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []int64{}
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
+
+// AssignToUser grants a role to a user. Assigning a role the user already holds does nothing. It returns ErrNotFound
+// if the user or the role does not exist.
+func (s *RoleStore) AssignToUser(ctx context.Context, userID, roleID int64) error {
+	query := `INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, userID, roleID); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// RemoveFromUser takes a role away from a user. The primary role of a user cannot be removed and ErrRoleInUse is
+// returned.
+func (s *RoleStore) RemoveFromUser(ctx context.Context, userID, roleID int64) error {
+	query := `DELETE FROM user_roles ur
+			  WHERE ur.user_id = $1 AND ur.role_id = $2
+			  AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = ur.user_id AND u.role_id = ur.role_id)
+			  RETURNING ur.role_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var removed int64
+	err := s.db.QueryRowContext(ctx, query, userID, roleID).Scan(&removed)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// Tell a primary role apart from a role the user does not hold
+	var primary bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND role_id = $2)`, userID, roleID).
+		Scan(&primary)
+	if err != nil {
+		return err
+	}
+	if primary {
+		return ErrRoleInUse
+	}
+
+	return ErrNotFound
+}
+
+// setRolePermissions replaces the permissions granted by a role. It returns ErrUnknownPermission if a permission
+// does not exist.
+func setRolePermissions(ctx context.Context, tx *sql.Tx, role *Role) error {
+	permissions := slices.Clone(role.Permissions)
+	slices.Sort(permissions)
+	permissions = slices.Compact(permissions)
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, role.ID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO role_permissions (role_id, permission_id)
+			  SELECT $1, id FROM permissions WHERE name = ANY($2)`
+
+	res, err := tx.ExecContext(ctx, query, role.ID, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != int64(len(permissions)) {
+		return ErrUnknownPermission
+	}
+
+	role.Permissions = permissions
+	return nil
+}
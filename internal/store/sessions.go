@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTokenReused is returned when a refresh token that was already rotated is presented again.
+var ErrTokenReused = errors.New("refresh token reuse detected")
+
+// Session represents a login of a user, shared by every refresh token rotated from it.
+type Session struct {
+	ID        string  `json:"id"`
+	UserID    int64   `json:"user_id"` // ID of the user who owns the session
+	CreatedAt string  `json:"created_at"`
+	RevokedAt *string `json:"revoked_at"` // Time the session was revoked, nil while it is active
+}
+
+// SessionStore implements the Storage interface for sessions and their refresh tokens.
+type SessionStore struct {
+	db *sql.DB
+}
+
+// Create inserts a new session for a user along with its first refresh token.
+func (s *SessionStore) Create(ctx context.Context, session *Session, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO sessions (user_id) VALUES ($1) RETURNING id, created_at`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, session.UserID).Scan(&session.ID, &session.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return s.createRefreshToken(ctx, tx, session.ID, token, exp)
+	})
+}
+
+// GetByID retrieves a session by its ID.
+func (s *SessionStore) GetByID(ctx context.Context, sessionID string) (*Session, error) {
+	query := `SELECT id, user_id, created_at, revoked_at FROM sessions WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	session := &Session{}
+	err := s.db.QueryRowContext(ctx, query, sessionID).
+		Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same session. A token can only be rotated once: presenting
+// it again means it was stolen, so the whole session is revoked and ErrTokenReused is returned.
+func (s *SessionStore) Rotate(ctx context.Context, token, newToken string, exp time.Duration) (*Session, error) {
+	session := &Session{}
+	reused := false
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `SELECT s.id, s.user_id, s.created_at, s.revoked_at, rt.expiry, rt.used_at
+				  FROM refresh_tokens rt JOIN sessions s ON s.id = rt.session_id
+				  WHERE rt.token = $1
+				  FOR UPDATE OF rt`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var expiry time.Time
+		var usedAt *time.Time
+		err := tx.QueryRowContext(ctx, query, token).
+			Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.RevokedAt, &expiry, &usedAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if session.RevokedAt != nil {
+			return ErrNotFound
+		}
+
+		// the token was already rotated, revoke the whole family and keep the revocation. This holds for expired
+		// tokens too, or a thief could wait for the token to expire before replaying it
+		if usedAt != nil {
+			reused = true
+			return s.revoke(ctx, tx, session.ID)
+		}
+
+		if expiry.Before(time.Now()) {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE token = $1`, token); err != nil {
+			return err
+		}
+
+		return s.createRefreshToken(ctx, tx, session.ID, newToken, exp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		return nil, ErrTokenReused
+	}
+
+	return session, nil
+}
+
+// Revoke revokes a session, invalidating its refresh tokens and the access tokens issued from it.
+func (s *SessionStore) Revoke(ctx context.Context, sessionID string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.revoke(ctx, tx, sessionID)
+	})
+}
+
+// RevokeByToken revokes the session a refresh token belongs to.
+func (s *SessionStore) RevokeByToken(ctx context.Context, token string) error {
+	query := `UPDATE sessions SET revoked_at = NOW()
+			  WHERE id = (SELECT session_id FROM refresh_tokens WHERE token = $1) AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, token)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// createRefreshToken inserts a new refresh token for a session.
+func (s *SessionStore) createRefreshToken(ctx context.Context, tx *sql.Tx, sessionID, token string, exp time.Duration) error {
+	query := `INSERT INTO refresh_tokens (token, session_id, expiry) VALUES ($1, $2, $3)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, token, sessionID, time.Now().Add(exp))
+	return err
+}
+
+// revoke marks a session as revoked.
+func (s *SessionStore) revoke(ctx context.Context, tx *sql.Tx, sessionID string) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, sessionID)
+	return err
+}
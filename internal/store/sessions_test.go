@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRotate(t *testing.T) {
+	const sessionID = "6f1c2d3e-4b5a-4c7d-8e9f-0a1b2c3d4e5f"
+
+	tests := []struct {
+		name     string
+		expiry   time.Time
+		usedAt   *time.Time
+		revoked  bool
+		expected error
+	}{
+		{"should rotate an unused token", time.Now().Add(time.Hour), nil, false, nil},
+		{"should revoke the session when a rotated token is replayed", time.Now().Add(time.Hour), ptr(time.Now()), false, ErrTokenReused},
+		{"should revoke the session when an expired rotated token is replayed", time.Now().Add(-time.Hour), ptr(time.Now()), false, ErrTokenReused},
+		{"should reject an expired token", time.Now().Add(-time.Hour), nil, false, ErrNotFound},
+		{"should reject a token of a revoked session", time.Now().Add(time.Hour), ptr(time.Now()), true, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			var revokedAt *string
+			if tt.revoked {
+				revokedAt = ptr(time.Now().Format(time.RFC3339))
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT s.id, s.user_id, s.created_at, s.revoked_at, rt.expiry, rt.used_at`).
+				WithArgs("token").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "created_at", "revoked_at", "expiry", "used_at"}).
+					AddRow(sessionID, 1, time.Now().Format(time.RFC3339), revokedAt, tt.expiry, tt.usedAt))
+			switch {
+			case tt.expected == nil:
+				mock.ExpectExec(`UPDATE refresh_tokens SET used_at`).WithArgs("token").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO refresh_tokens`).WithArgs("new-token", sessionID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			case errors.Is(tt.expected, ErrTokenReused):
+				// the revocation must be committed even though the rotation fails
+				mock.ExpectExec(`UPDATE sessions SET revoked_at`).WithArgs(sessionID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			default:
+				mock.ExpectRollback()
+			}
+
+			store := &SessionStore{db}
+			session, err := store.Rotate(context.Background(), "token", "new-token", time.Hour)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("Expected error %v, got %v", tt.expected, err)
+			}
+			if tt.expected == nil && session.ID != sessionID {
+				t.Errorf("Expected the token to be rotated in session %s, got %s", sessionID, session.ID)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -22,44 +22,185 @@ type Storage struct {
 		Delete(context.Context, string) error
 		Update(context.Context, *Post) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostsForFeed, error) // Get posts for a specific user
+		LoadOriginals(context.Context, int64, []*Post) error                            // Attach the reposted and quoted posts
+		DeleteRepost(context.Context, int64, int64) error                               // Undo the repost of a post by a user
+		GetRevisions(context.Context, int64) ([]*PostRevision, error)                   // Get the previous versions of a post
+		GetRevision(context.Context, int64, int64) (*PostRevision, error)               // Get a previous version of a post
+		PublishScheduled(context.Context, int) (int64, error)                           // Publish the scheduled posts that are due
 	}
 
 	// Users provides methods for managing users.
 	Users interface {
-		GetByID(context.Context, string) (*User, error)                      // Get user by ID
-		GetByEmail(context.Context, string) (*User, error)                   // Get user by email
-		Create(context.Context, *sql.Tx, *User) error                        // Create a user
-		Delete(context.Context, int64) error                                 // Delete a user
-		CreateAndInvite(context.Context, *User, string, time.Duration) error // Create a user and send an invitation email
-		Activate(context.Context, string) error                              // Activate a user account with a token
+		GetByID(context.Context, string) (*User, error)                                   // Get user by ID
+		GetByEmail(context.Context, string) (*User, error)                                // Get user by email
+		Create(context.Context, *sql.Tx, *User) error                                     // Create a user
+		Delete(context.Context, int64) error                                              // Delete a user
+		CreateAndInvite(context.Context, *User, string, time.Duration) error              // Create a user and send an invitation email
+		Activate(context.Context, string) (int64, error)                                  // Activate a user account with a token
+		CreatePasswordReset(context.Context, int64, string, time.Duration) error          // Create a password reset token
+		ResetPassword(context.Context, string, *User) error                               // Reset a password with a token
+		RotateInvitation(context.Context, string, string, time.Duration) (*User, error)   // Replace the invitation of an inactive user
+		GetPendingInvitations(context.Context, PaginatedFeedQuery) ([]*Invitation, error) // Get a page of inactive users
+		DeleteUnactivated(context.Context, time.Duration) (int64, error)                  // Purge users who never activated
+		CreateWithIdentity(context.Context, *User, *Identity) error                       // Create an active user with a linked identity
 	}
 
 	// Comments provides methods for managing comments.
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(context.Context, int64) ([]*Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)                            // Get comment by ID
+		Update(context.Context, *Comment) error                                      // Update a comment's content
+		Delete(context.Context, int64) error                                         // Delete a comment
+		GetByPostID(context.Context, int64) ([]*Comment, error)                      // Get all comments for a post
+		ListByPostID(context.Context, int64, PaginatedFeedQuery) ([]*Comment, error) // Get a page of comments for a post
+		// Get a page of comment threads for a post, with nested replies
+		GetThreads(context.Context, int64, CommentThreadQuery) ([]*Comment, string, error)
+		// Get a page of replies to a comment, with nested replies
+		GetReplies(context.Context, int64, CommentThreadQuery) ([]*Comment, string, error)
+	}
+
+	// Reactions provides methods for managing reactions to posts.
+	Reactions interface {
+		Add(context.Context, *Reaction) error                                                 // React to a post
+		Remove(context.Context, int64, int64, string) error                                   // Remove a reaction of a user
+		ListByPostID(context.Context, int64, string, PaginatedFeedQuery) ([]*Reaction, error) // Get a page of reactions to a post
+	}
+
+	// Bookmarks provides methods for managing the bookmark collections of users and the posts saved in them.
+	Bookmarks interface {
+		CreateCollection(context.Context, *BookmarkCollection) error              // Create a collection
+		GetCollections(context.Context, int64) ([]*BookmarkCollection, error)     // Get the collections of a user
+		GetCollection(context.Context, int64, int64) (*BookmarkCollection, error) // Get a collection of a user
+		DeleteCollection(context.Context, int64, int64) error                     // Delete a collection of a user
+		Add(context.Context, int64, int64) error                                  // Save a post in a collection
+		Remove(context.Context, int64, int64) error                               // Take a post out of a collection
+		GetPosts(context.Context, int64, PaginatedFeedQuery) ([]*Post, error)     // Get a page of the posts of a collection
+	}
+
+	// Media provides methods for managing uploaded files.
+	Media interface {
+		Create(context.Context, *Media) error                                // Record an upload
+		GetByID(context.Context, int64) (*Media, error)                      // Get an upload by ID
+		GetByPostIDs(context.Context, []int64) (map[int64][]*Media, error)   // Get the files attached to posts
+		GetUnattached(context.Context, time.Duration, int) ([]*Media, error) // Get uploads left unattached for a while
+		Delete(context.Context, int64) error                                 // Delete the record of an unattached upload
+		ClaimPending(context.Context, int, time.Duration) ([]*Media, error)  // Claim uploads waiting to be processed
+		SaveProcessed(context.Context, *Media) error                         // Record the result of processing an upload
+		MarkFailed(context.Context, int64) error                             // Record that an upload cannot be processed
+	}
+
+	// Mentions provides methods for reading the users mentioned in posts and comments, which are recorded when they are
+	// written.
+	Mentions interface {
+		GetByPostIDs(context.Context, []int64) (map[int64][]*Mention, error)             // Get the mentions in posts
+		GetByCommentIDs(context.Context, []int64) (map[int64][]*Mention, error)          // Get the mentions in comments
+		ListByUserID(context.Context, int64, PaginatedFeedQuery) ([]*MentionedIn, error) // Get a page of where a user was mentioned
+	}
+
+	// Notifications provides methods for managing the notifications of users.
+	Notifications interface {
+		ListByUserID(context.Context, int64, bool, PaginatedFeedQuery) ([]*Notification, error) // Get a page of the notifications of a user
+		MarkRead(context.Context, int64, int64) error                                           // Mark a notification of a user read
+		MarkAllRead(context.Context, int64) (int64, error)                                      // Mark every notification of a user read
 	}
 
 	// Followers provides methods for managing user relationships.
 	Followers interface {
-		Follow(ctx context.Context, toFollowID int64, userID int64) error     // Follow another user
-		Unfollow(ctx context.Context, toUnfollowID int64, userID int64) error // Unfollow another user
+		Follow(ctx context.Context, toFollowID int64, userID int64) error              // Follow another user
+		Unfollow(ctx context.Context, toUnfollowID int64, userID int64) error          // Unfollow another user
+		IsFollowing(ctx context.Context, followedID int64, userID int64) (bool, error) // Check whether a user follows another
+	}
+
+	// Sessions provides methods for managing login sessions and their refresh tokens.
+	Sessions interface {
+		Create(context.Context, *Session, string, time.Duration) error           // Create a session with its first refresh token
+		GetByID(context.Context, string) (*Session, error)                       // Get session by ID
+		Rotate(context.Context, string, string, time.Duration) (*Session, error) // Exchange a refresh token for a new one
+		Revoke(context.Context, string) error                                    // Revoke a session by ID
+		RevokeByToken(context.Context, string) error                             // Revoke the session of a refresh token
+	}
+
+	// MFA provides methods for managing two-factor authentication settings.
+	MFA interface {
+		GetByUserID(context.Context, int64) (*MFA, error)     // Get the settings of a user
+		Enroll(context.Context, int64, []byte) error          // Store a new secret for a user
+		Enable(context.Context, int64, int64, []string) error // Enable with a verified step and recovery codes
+		Disable(context.Context, int64) error                 // Remove the settings of a user
+		UseStep(context.Context, int64, int64) error          // Record an accepted time step
+		UseRecoveryCode(context.Context, int64, string) error // Consume a recovery code
+	}
+
+	// APIKeys provides methods for managing personal API keys.
+	APIKeys interface {
+		Create(context.Context, *APIKey, string, time.Duration) error // Create a key with the hash of its secret
+		GetByUserID(context.Context, int64) ([]*APIKey, error)        // Get the keys of a user
+		Delete(context.Context, int64, int64) error                   // Delete a key of a user
+		Authenticate(context.Context, string) (*APIKey, error)        // Get an unexpired key by hash and mark it used
+	}
+
+	// LoginFailures provides methods for tracking failed logins and locking out brute-force attempts.
+	LoginFailures interface {
+		GetLockedUntil(context.Context, string, string) (*time.Time, error)        // Get the end of the lock of a key
+		RecordFailure(context.Context, string, string, time.Duration) (int, error) // Count a failed login
+		Lock(context.Context, string, string, time.Duration) error                 // Lock a key for a duration
+		Reset(context.Context, string, string) error                               // Clear the failures of a key
+	}
+
+	// LoginLinks provides methods for managing passwordless sign-in links.
+	LoginLinks interface {
+		Create(context.Context, *LoginLink, string, time.Duration) error // Create a link with the hash of its token
+		Consume(context.Context, string) (*LoginLink, error)             // Get and delete an unexpired link by token hash
+	}
+
+	// Identities provides methods for managing identities at external providers and the logins in progress there.
+	Identities interface {
+		GetByProviderSubject(context.Context, string, string) (*Identity, error)        // Get an identity
+		Link(context.Context, *Identity) error                                          // Link an identity to a user
+		CreateLoginState(context.Context, *OIDCLoginState, string, time.Duration) error // Store a login in progress
+		ConsumeLoginState(context.Context, string) (*OIDCLoginState, error)             // Get and delete a login in progress
 	}
 
 	// Roles provides methods for managing user roles.
 	Roles interface {
-		GetByName(ctx context.Context, name string) (*Role, error) // Get role by name
+		GetByName(ctx context.Context, name string) (*Role, error)              // Get role by name
+		GetUserPermissions(ctx context.Context, userID int64) ([]string, error) // Get the permissions of a user
+		List(ctx context.Context) ([]*Role, error)                              // Get all roles with their permissions
+		GetByID(ctx context.Context, roleID int64) (*Role, error)               // Get role with its permissions by ID
+		Create(ctx context.Context, role *Role) error                           // Create a role with its permissions
+		Update(ctx context.Context, role *Role) error                           // Replace a role and its permissions
+		Delete(ctx context.Context, roleID int64) error                         // Delete a role
+		GetUserIDs(ctx context.Context, roleID int64) ([]int64, error)          // Get the users holding a role
+		AssignToUser(ctx context.Context, userID, roleID int64) error           // Grant a role to a user
+		RemoveFromUser(ctx context.Context, userID, roleID int64) error         // Take a role away from a user
+	}
+
+	// Audit provides methods for recording and querying the audit trail.
+	Audit interface {
+		Create(context.Context, *AuditEvent) error               // Record an audit event
+		List(context.Context, AuditQuery) ([]*AuditEvent, error) // Get a page of audit events matching filters
 	}
 }
 
 // NewStorage creates a new Storage instance with the provided database connection.
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &CommentStore{db},
-		Followers: &FollowerStore{db},
-		Roles:     &RoleStore{db},
+		Posts:         &PostStore{db},
+		Users:         &UserStore{db},
+		Comments:      &CommentStore{db},
+		Followers:     &FollowerStore{db},
+		Roles:         &RoleStore{db},
+		Sessions:      &SessionStore{db},
+		MFA:           &MFAStore{db},
+		APIKeys:       &APIKeyStore{db},
+		LoginFailures: &LoginFailureStore{db},
+		LoginLinks:    &LoginLinkStore{db},
+		Identities:    &IdentityStore{db},
+		Audit:         &AuditStore{db},
+		Reactions:     &ReactionStore{db},
+		Bookmarks:     &BookmarkStore{db},
+		Media:         &MediaStore{db},
+		Mentions:      &MentionStore{db},
+		Notifications: &NotificationStore{db},
 	}
 }
 
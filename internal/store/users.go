@@ -61,9 +61,14 @@ type UserStore struct {
 
 // Create inserts a new user into the database.
 func (u *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
-	query := `INSERT INTO users (username, email, password, role_id) VALUES ($1, $2, $3, (
-    		  SELECT id FROM roles WHERE name = $4 LIMIT 1))
-			  RETURNING id, created_at, updated_at`
+	query := `WITH u AS (
+				  INSERT INTO users (username, email, password, role_id) VALUES ($1, $2, $3, (
+				  SELECT id FROM roles WHERE name = $4 LIMIT 1))
+				  RETURNING id, role_id, created_at, updated_at
+			  ), ur AS (
+				  INSERT INTO user_roles (user_id, role_id) SELECT id, role_id FROM u
+			  )
+			  SELECT id, created_at, updated_at FROM u`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -276,8 +281,9 @@ func (u *UserStore) deleteUserInvitation(ctx context.Context, tx *sql.Tx, userID
 }
 
 // Activate activates a user account using a token.
-func (u *UserStore) Activate(ctx context.Context, token string) error {
-	return withTx(u.db, ctx, func(tx *sql.Tx) error {
+func (u *UserStore) Activate(ctx context.Context, token string) (int64, error) {
+	var userID int64
+	err := withTx(u.db, ctx, func(tx *sql.Tx) error {
 		// Get the user associated with the token
 		user, err := u.getUserFromInvitation(ctx, tx, token)
 		if err != nil {
@@ -298,6 +304,193 @@ func (u *UserStore) Activate(ctx context.Context, token string) error {
 			return err
 		}
 
+		userID = user.ID
 		return nil
 	})
+
+	return userID, err
+}
+
+// CreatePasswordReset stores a password reset token for a user, replacing any reset token issued before.
+func (u *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(u.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+		_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ResetPassword sets the password of the user a valid reset token was issued for to the password of the given user,
+// consumes the token, and revokes every session and deletes every API key of the user. The ID of the user is set on
+// success.
+func (u *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(u.db, ctx, func(tx *sql.Tx) error {
+		query := `SELECT user_id FROM password_resets WHERE token = $1 AND expiry > $2 FOR UPDATE`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(&user.ID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		query = `UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2`
+		if _, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1`, user.ID); err != nil {
+			return err
+		}
+
+		// sign the user out everywhere, whoever knew the old password may still hold a session
+		query = `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+		if _, err := tx.ExecContext(ctx, query, user.ID); err != nil {
+			return err
+		}
+
+		// and may have created an API key that would outlive the session
+		_, err = tx.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = $1`, user.ID)
+		return err
+	})
+}
+
+// Invitation represents the pending activation of a user account.
+type Invitation struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"` // Time the user registered
+	Expiry    string `json:"expiry"`     // Time the current activation link expires
+	Expired   bool   `json:"expired"`
+}
+
+// RotateInvitation replaces the invitation token of the not yet activated user with the given email and returns the
+// user. It returns ErrNotFound if no such user exists.
+func (u *UserStore) RotateInvitation(ctx context.Context, email string, token string, exp time.Duration) (*User, error) {
+	user := &User{}
+
+	err := withTx(u.db, ctx, func(tx *sql.Tx) error {
+		query := `SELECT id, username, email, created_at, updated_at, is_active FROM users
+				  WHERE email = $1 AND is_active = false FOR UPDATE`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, email).
+			Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.IsActive)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if err := u.deleteUserInvitation(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		return u.createUserInvitation(ctx, tx, token, exp, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetPendingInvitations retrieves a page of the users who have not activated their account yet, honoring the limit,
+// offset, sort and search parameters of the query. The search matches usernames and emails.
+func (u *UserStore) GetPendingInvitations(ctx context.Context, fq PaginatedFeedQuery) ([]*Invitation, error) {
+	// Handle sort parameter safely
+	sortDir := "DESC"
+	if fq.Sort == "asc" {
+		sortDir = "ASC"
+	}
+
+	query := `SELECT u.id, u.username, u.email, u.created_at, COALESCE(MAX(ui.expiry), u.created_at),
+			  COALESCE(MAX(ui.expiry), u.created_at) <= NOW()
+			  FROM users u
+			  LEFT JOIN user_invitations ui ON ui.user_id = u.id
+			  WHERE u.is_active = false AND ($3 = '' OR u.username ILIKE '%' || $3 || '%' OR u.email ILIKE '%' || $3 || '%')
+			  GROUP BY u.id
+			  ORDER BY u.created_at ` + sortDir + `, u.id ` + sortDir + `
+			  LIMIT $1 OFFSET $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.QueryContext(ctx, query, fq.Limit, fq.Offset, fq.Search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		i := &Invitation{}
+		if err := rows.Scan(&i.UserID, &i.Username, &i.Email, &i.CreatedAt, &i.Expiry, &i.Expired); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// DeleteUnactivated deletes the users who registered more than the grace period ago and never activated their
+// account, along with their invitations, and returns how many were deleted. Users holding an unexpired invitation
+// are kept, so that a link resent late in the grace period can still be used.
+func (u *UserStore) DeleteUnactivated(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	query := `WITH deleted AS (
+				  DELETE FROM users u
+				  WHERE u.is_active = false AND u.created_at < NOW() - $1 * INTERVAL '1 second'
+				  AND NOT EXISTS (SELECT 1 FROM user_invitations ui WHERE ui.user_id = u.id AND ui.expiry > NOW())
+				  RETURNING u.id
+			  ), invitations AS (
+				  DELETE FROM user_invitations WHERE user_id IN (SELECT id FROM deleted)
+			  )
+			  SELECT COUNT(*) FROM deleted`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int64
+	if err := u.db.QueryRowContext(ctx, query, gracePeriod.Seconds()).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CreateWithIdentity creates an active user for an identity whose email the provider verified, and links it.
+func (u *UserStore) CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	return withTx(u.db, ctx, func(tx *sql.Tx) error {
+		if err := u.Create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		// No invitation is needed, the provider already proved the user owns the email
+		user.IsActive = true
+		if err := u.updateUser(ctx, tx, user); err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return createIdentity(ctx, tx, identity)
+	})
 }
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestResetPassword(t *testing.T) {
+	const userID = 7
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT user_id FROM password_resets`).
+		WithArgs("token", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
+	mock.ExpectExec(`UPDATE users SET password`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM password_resets`).WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE sessions SET revoked_at`).WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM api_keys WHERE user_id`).WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	user := &User{}
+	if err := user.Password.Set("new-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &UserStore{db}
+	if err := store.ResetPassword(context.Background(), "token", user); err != nil {
+		t.Fatalf("Expected the password to be reset, got %v", err)
+	}
+	if user.ID != userID {
+		t.Errorf("Expected the ID of the user to be set to %d, got %d", userID, user.ID)
+	}
+
+	// the sessions and API keys must go in the same transaction as the password
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
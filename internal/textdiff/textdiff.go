@@ -0,0 +1,128 @@
+// Package textdiff computes line-based differences between texts and formats them as unified diffs.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// op is a line of an edit script: kept (' '), deleted ('-') or inserted ('+').
+type op struct {
+	kind byte
+	line string
+}
+
+// Unified returns the unified diff turning a into b, with the given names in its header and n lines of context
+// around each change. It returns an empty string when the texts have the same lines. The diff is computed from the
+// longest common subsequence of lines, in time and space proportional to the product of the line counts, which suits
+// texts the size of posts.
+func Unified(fromName, toName, a, b string, n int) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var changes []int
+	for i, o := range ops {
+		if o.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	// aPos[i] and bPos[i] are the numbers of lines of a and b before ops[i]
+	aPos, bPos := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, o := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if o.kind != '+' {
+			aPos[i+1]++
+		}
+		if o.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	// Changes closer than twice the context share a hunk
+	for first := 0; first < len(changes); {
+		last := first
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*n+1 {
+			last++
+		}
+
+		start := max(changes[first]-n, 0)
+		end := min(changes[last]+n+1, len(ops))
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aPos[start], aPos[end]-aPos[start]),
+			hunkRange(bPos[start], bPos[end]-bPos[start]))
+		for _, o := range ops[start:end] {
+			sb.WriteByte(o.kind)
+			sb.WriteString(o.line)
+			sb.WriteByte('\n')
+		}
+
+		first = last + 1
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats the range of a hunk on one side, from the number of lines before it and its number of lines.
+// Following diff, the count is left out when it is 1, and an empty range starts at the line before it.
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
+
+// splitLines splits a text into lines, ignoring the final newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the edit script turning a into b, deletions before insertions within a change.
+func diffLines(a, b []string) []op {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+
+	return ops
+}
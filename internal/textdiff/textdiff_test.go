@@ -0,0 +1,47 @@
+package textdiff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	t.Run("should return nothing for equal texts", func(t *testing.T) {
+		if diff := Unified("a", "b", "one\ntwo\n", "one\ntwo", 3); diff != "" {
+			t.Errorf("expected no diff, got %q", diff)
+		}
+	})
+
+	t.Run("should show changes with context", func(t *testing.T) {
+		a := "one\ntwo\nthree\nfour\nfive"
+		b := "one\ntwo\n3\nfour\nfive\nsix"
+
+		expected := "--- v1\n+++ v2\n" +
+			"@@ -2,4 +2,5 @@\n" +
+			" two\n-three\n+3\n four\n five\n+six\n"
+		if diff := Unified("v1", "v2", a, b, 1); diff != expected {
+			t.Errorf("unexpected diff:\n%s\nexpected:\n%s", diff, expected)
+		}
+	})
+
+	t.Run("should split distant changes into hunks", func(t *testing.T) {
+		a := "a\nb\nc\nd\ne\nf\ng"
+		b := "A\nb\nc\nd\ne\nf\nG"
+
+		expected := "--- v1\n+++ v2\n" +
+			"@@ -1,2 +1,2 @@\n-a\n+A\n b\n" +
+			"@@ -6,2 +6,2 @@\n f\n-g\n+G\n"
+		if diff := Unified("v1", "v2", a, b, 1); diff != expected {
+			t.Errorf("unexpected diff:\n%s\nexpected:\n%s", diff, expected)
+		}
+	})
+
+	t.Run("should handle empty texts", func(t *testing.T) {
+		expected := "--- v1\n+++ v2\n@@ -0,0 +1 @@\n+hello\n"
+		if diff := Unified("v1", "v2", "", "hello", 3); diff != expected {
+			t.Errorf("unexpected diff:\n%s\nexpected:\n%s", diff, expected)
+		}
+
+		expected = "--- v1\n+++ v2\n@@ -1,2 +0,0 @@\n-hello\n-world\n"
+		if diff := Unified("v1", "v2", "hello\nworld", "", 3); diff != expected {
+			t.Errorf("unexpected diff:\n%s\nexpected:\n%s", diff, expected)
+		}
+	})
+}